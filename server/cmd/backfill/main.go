@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/config"
+	"github.com/Mahaveer86619/TrailStory/pkg/db"
+	"github.com/Mahaveer86619/TrailStory/pkg/services"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/geocoder"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+)
+
+// Generates image variants for media and avatars uploaded before variants
+// existed, and records the sizes counted towards storage quotas. Safe to
+// re-run: rows that already have variants or sizes are skipped.
+func main() {
+	local := flag.Bool("local", false, "connect to the database on localhost instead of DB_HOST")
+	flag.Parse()
+
+	config.LoadConfig()
+	db.InitTrailStoryDB(*local)
+
+	storageSvc := storage.NewStorageService()
+	if err := storageSvc.Init(); err != nil {
+		log.Fatalf("Failed to init storage: %v", err)
+	}
+
+	journeySvc := services.NewJourneyService(storageSvc, geocoder.NoopGeocoder{})
+	filled, err := journeySvc.BackfillMediaVariants()
+	if err != nil {
+		log.Fatalf("Media backfill stopped after %d rows: %v", filled, err)
+	}
+	log.Printf("Generated variants for %d media", filled)
+
+	userSvc := services.NewUserService(storageSvc)
+	filled, err = userSvc.BackfillAvatarVariants()
+	if err != nil {
+		log.Fatalf("Avatar backfill stopped after %d users: %v", filled, err)
+	}
+	log.Printf("Generated variants for %d avatars", filled)
+
+	filled, err = journeySvc.BackfillMediaSizes()
+	if err != nil {
+		log.Fatalf("Media size backfill stopped after %d rows: %v", filled, err)
+	}
+	log.Printf("Recorded sizes of %d media", filled)
+
+	filled, err = userSvc.BackfillAvatarSizes()
+	if err != nil {
+		log.Fatalf("Avatar size backfill stopped after %d users: %v", filled, err)
+	}
+	log.Printf("Recorded sizes of %d avatars", filled)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/config"
+	"github.com/Mahaveer86619/TrailStory/pkg/db"
+	"github.com/Mahaveer86619/TrailStory/pkg/services"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+)
+
+// Deletes stored files that no media row or avatar refers to any more, such
+// as uploads that failed half way or files whose deletion failed.
+func main() {
+	local := flag.Bool("local", false, "connect to the database on localhost instead of DB_HOST")
+	grace := flag.Duration("grace", 24*time.Hour, "keep orphans younger than this")
+	dryRun := flag.Bool("dry-run", false, "list orphans without deleting them")
+	flag.Parse()
+
+	config.LoadConfig()
+	db.InitTrailStoryDB(*local)
+
+	storageSvc := storage.NewStorageService()
+	if err := storageSvc.Init(); err != nil {
+		log.Fatalf("Failed to init storage: %v", err)
+	}
+
+	report, err := services.NewStorageGC(storageSvc).Run(*grace, *dryRun)
+	if err != nil {
+		log.Fatalf("Garbage collection failed: %v", err)
+	}
+
+	if *dryRun {
+		log.Printf("Scanned %d files, found %d orphans (dry run, nothing deleted)", report.Scanned, report.Orphans)
+		return
+	}
+	log.Printf("Scanned %d files, deleted %d of %d orphans, freed %d bytes", report.Scanned, report.Deleted, report.Orphans, report.FreedBytes)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/Mahaveer86619/TrailStory/pkg/handlers"
 	"github.com/Mahaveer86619/TrailStory/pkg/middleware"
 	"github.com/Mahaveer86619/TrailStory/pkg/services"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/geocoder"
 	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
 )
 
@@ -27,10 +28,12 @@ func main() {
 		log.Fatalf("Failed to init storage: %v", err)
 	}
 
+	geocoderSvc := geocoder.NewGeocoder()
+
 	userSvc := services.NewUserService(storageSvc)
 	userHandler := handlers.NewUserHandler(*userSvc)
 
-	journeySvc := services.NewJourneyService(storageSvc)
+	journeySvc := services.NewJourneyService(storageSvc, geocoderSvc)
 	journeyHandler := handlers.NewJourneyHandler(journeySvc)
 
 	// 3. Routing
@@ -52,7 +55,12 @@ func main() {
 	mux.HandleFunc("GET /users/{id}/followers", userHandler.GetFollowers)
 	// Optional Auth
 	mux.HandleFunc("GET /journeys/{id}", middleware.OptionalAuth(journeyHandler.Get))
+	mux.HandleFunc("GET /journeys/{id}/export.gpx", middleware.OptionalAuth(journeyHandler.ExportGPX))
+	mux.HandleFunc("GET /journeys/{id}/export.kml", middleware.OptionalAuth(journeyHandler.ExportKML))
+	mux.HandleFunc("GET /journeys/{id}/live", middleware.OptionalAuth(journeyHandler.Live))
+	mux.HandleFunc("GET /journeys/nearby", middleware.OptionalAuth(journeyHandler.Nearby))
 	mux.HandleFunc("GET /feed", middleware.OptionalAuth(journeyHandler.ListPublic))
+	mux.HandleFunc("GET /map/viewport", middleware.OptionalAuth(journeyHandler.Viewport))
 
 	// --- Protected Routes ---
 
@@ -60,20 +68,37 @@ func main() {
 	mux.HandleFunc("GET /users/me", middleware.Middleware(userHandler.GetMe))
 	mux.HandleFunc("PATCH /users/me", middleware.Middleware(userHandler.UpdateMe))
 	mux.HandleFunc("POST /users/me/avatar", middleware.Middleware(userHandler.UploadAvatar))
+	mux.HandleFunc("DELETE /users/me/avatar", middleware.Middleware(userHandler.RemoveAvatar))
 	mux.HandleFunc("POST /users/follow/{id}", middleware.Middleware(userHandler.Follow))
 	mux.HandleFunc("DELETE /users/unfollow/{id}", middleware.Middleware(userHandler.Unfollow))
 
 	// Journey
 	mux.HandleFunc("POST /journeys", middleware.Middleware(journeyHandler.Create))
 	mux.HandleFunc("GET /journeys", middleware.Middleware(journeyHandler.ListMine))
+	mux.HandleFunc("POST /journeys/import", middleware.Middleware(journeyHandler.Import))
+	mux.HandleFunc("PATCH /journeys/{id}", middleware.Middleware(journeyHandler.Update))
 	mux.HandleFunc("DELETE /journeys/{id}", middleware.Middleware(journeyHandler.Delete))
+	mux.HandleFunc("POST /journeys/{id}/finish", middleware.Middleware(journeyHandler.Finish))
+	mux.HandleFunc("POST /journeys/{id}/reopen", middleware.Middleware(journeyHandler.Reopen))
 	mux.HandleFunc("POST /journeys/{id}/checkpoints", middleware.Middleware(journeyHandler.AddCheckpoint))
+	mux.HandleFunc("POST /journeys/{id}/checkpoints/batch", middleware.Middleware(journeyHandler.AddCheckpointsBatch))
+	mux.HandleFunc("POST /journeys/{id}/photos", middleware.Middleware(journeyHandler.ImportPhotos))
+	mux.HandleFunc("PATCH /checkpoints/{id}", middleware.Middleware(journeyHandler.UpdateCheckpoint))
 	mux.HandleFunc("DELETE /checkpoints/{id}", middleware.Middleware(journeyHandler.DeleteCheckpoint))
+	mux.HandleFunc("POST /checkpoints/{id}/media", middleware.Middleware(journeyHandler.UploadMedia))
+	mux.HandleFunc("POST /checkpoints/{id}/media/uploads", middleware.Middleware(journeyHandler.CreateMediaUpload))
+	mux.HandleFunc("POST /checkpoints/{id}/media/uploads/complete", middleware.Middleware(journeyHandler.CompleteMediaUpload))
 
-	// Static File Server (For Local Storage Driver)
+	// Static File Server and direct uploads (For Local Storage Driver)
 	if config.AppConfig.STORAGE_DRIVER == "local" {
-		fileServer := http.FileServer(http.Dir(config.AppConfig.STORAGE_PATH))
-		mux.Handle("/static/", http.StripPrefix("/static/", fileServer))
+		storageHandler := handlers.NewStorageHandler(
+			storageSvc.(*storage.LocalStorage),
+			config.AppConfig.STORAGE_PATH,
+			journeySvc.IsPublicMedia,
+		)
+		mux.HandleFunc("GET /static/", storageHandler.Serve)
+		// The signed URL is the authorization
+		mux.HandleFunc("PUT /storage/upload", storageHandler.Upload)
 	}
 
 	// 4. Start Server
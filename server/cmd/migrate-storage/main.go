@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/config"
+	"github.com/Mahaveer86619/TrailStory/pkg/db"
+	"github.com/Mahaveer86619/TrailStory/pkg/services"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+)
+
+// Copies every stored file the database refers to from one storage driver to
+// the other, e.g. from local uploads to S3. Both drivers are configured from
+// the usual environment; -path overrides STORAGE_PATH for the local one.
+// Re-running resumes from the journal, which is kept per direction. Switch
+// STORAGE_DRIVER afterwards.
+func main() {
+	local := flag.Bool("local", false, "connect to the database on localhost instead of DB_HOST")
+	from := flag.String("from", "", "source driver: local or s3")
+	to := flag.String("to", "", "destination driver: local or s3")
+	path := flag.String("path", "", "directory of the local driver, instead of STORAGE_PATH")
+	journal := flag.String("journal", "", "file recording verified copies, for resuming (default storage-migration-<from>-to-<to>.log)")
+	dryRun := flag.Bool("dry-run", false, "report what would be copied without copying")
+	flag.Parse()
+
+	if !validDriver(*from) || !validDriver(*to) || *from == *to {
+		log.Fatalf("-from and -to must be two different drivers: local or s3")
+	}
+
+	if *journal == "" {
+		*journal = fmt.Sprintf("storage-migration-%s-to-%s.log", *from, *to)
+	}
+
+	config.LoadConfig()
+	db.InitTrailStoryDB(*local)
+
+	cfg := config.AppConfig
+	if *path != "" {
+		cfg.STORAGE_PATH = *path
+	}
+
+	source := storage.NewDriver(*from, &cfg)
+	if err := source.HealthCheck(); err != nil {
+		log.Fatalf("Source storage is not available: %v", err)
+	}
+	destination := storage.NewDriver(*to, &cfg)
+	if err := destination.Init(); err != nil {
+		log.Fatalf("Failed to init destination storage: %v", err)
+	}
+
+	report, err := services.NewStorageMigration(source, destination, *from+" -> "+*to, *journal).Run(*dryRun)
+	if err != nil {
+		log.Fatalf("Migration stopped: %v", err)
+	}
+
+	if *dryRun {
+		log.Printf("%d referenced, %d already copied, %d missing; would copy %d bytes",
+			report.Referenced, report.Skipped, report.Missing, report.Bytes)
+		return
+	}
+	log.Printf("%d referenced: %d copied (%d bytes), %d already copied, %d missing, %d failed",
+		report.Referenced, report.Copied, report.Bytes, report.Skipped, report.Missing, report.Failed)
+	if report.Failed > 0 {
+		log.Fatalf("Some copies failed; run again to retry them")
+	}
+}
+
+func validDriver(name string) bool {
+	return name == "local" || name == "s3"
+}
@@ -22,8 +22,11 @@ type Config struct {
 
 	JWT_SECRET string
 
-	STORAGE_DRIVER string
-	STORAGE_PATH   string
+	STORAGE_DRIVER         string
+	STORAGE_PATH           string
+	STORAGE_SIGNING_SECRET string
+	STORAGE_DEDUPLICATE    string
+	STORAGE_QUOTA_MB       string
 
 	S3_ENDPOINT   string
 	S3_PUBLIC_URL string
@@ -31,6 +34,11 @@ type Config struct {
 	S3_REGION     string
 	S3_ACCESS_KEY string
 	S3_SECRET_KEY string
+
+	GEOCODER_DRIVER         string
+	GEOCODER_GAZETTEER_PATH string
+	GEOCODER_URL            string
+	GEOCODER_USER_AGENT     string
 }
 
 var AppConfig Config
@@ -53,8 +61,11 @@ func LoadConfig() {
 		ID_SALT:    getEnv("ID_SALT", "trailstory-secret-salt-change-me"),
 		JWT_SECRET: getEnv("JWT_SECRET", "your_secret_key"),
 
-		STORAGE_DRIVER: getEnv("STORAGE_DRIVER", "local"),
-		STORAGE_PATH:   getEnv("STORAGE_PATH", "./uploads"),
+		STORAGE_DRIVER:         getEnv("STORAGE_DRIVER", "local"),
+		STORAGE_PATH:           getEnv("STORAGE_PATH", "./uploads"),
+		STORAGE_SIGNING_SECRET: getEnv("STORAGE_SIGNING_SECRET", ""),
+		STORAGE_DEDUPLICATE:    getEnv("STORAGE_DEDUPLICATE", "false"),
+		STORAGE_QUOTA_MB:       getEnv("STORAGE_QUOTA_MB", "1024"),
 
 		S3_ENDPOINT:   getEnv("S3_ENDPOINT", ""),
 		S3_PUBLIC_URL: getEnv("S3_PUBLIC_URL", ""),
@@ -62,6 +73,11 @@ func LoadConfig() {
 		S3_REGION:     getEnv("S3_REGION", "us-east-1"),
 		S3_ACCESS_KEY: getEnv("S3_ACCESS_KEY", ""),
 		S3_SECRET_KEY: getEnv("S3_SECRET_KEY", ""),
+
+		GEOCODER_DRIVER:         getEnv("GEOCODER_DRIVER", "offline"),
+		GEOCODER_GAZETTEER_PATH: getEnv("GEOCODER_GAZETTEER_PATH", ""),
+		GEOCODER_URL:            getEnv("GEOCODER_URL", "https://nominatim.openstreetmap.org"),
+		GEOCODER_USER_AGENT:     getEnv("GEOCODER_USER_AGENT", "TrailStory"),
 	}
 }
 
@@ -16,6 +16,9 @@ const (
 	Conflict            ErrzType = "conflict"
 	Unauthorized        ErrzType = "unauthorized"
 	Forbidden           ErrzType = "forbidden"
+	PayloadTooLarge     ErrzType = "payload_too_large"
+	UnsupportedMedia    ErrzType = "unsupported_media_type"
+	QuotaExceeded       ErrzType = "quota_exceeded"
 	InternalServerError ErrzType = "internal_server_error"
 )
 
@@ -25,6 +28,9 @@ var statusMap = map[ErrzType]int{
 	Conflict:            http.StatusConflict,
 	Unauthorized:        http.StatusUnauthorized,
 	Forbidden:           http.StatusForbidden,
+	PayloadTooLarge:     http.StatusRequestEntityTooLarge,
+	UnsupportedMedia:    http.StatusUnsupportedMediaType,
+	QuotaExceeded:       http.StatusRequestEntityTooLarge,
 	InternalServerError: http.StatusInternalServerError,
 }
 
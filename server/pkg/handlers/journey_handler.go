@@ -1,14 +1,25 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Mahaveer86619/TrailStory/pkg/errz"
 	"github.com/Mahaveer86619/TrailStory/pkg/middleware"
 	"github.com/Mahaveer86619/TrailStory/pkg/services"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/live"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/upload"
 	"github.com/Mahaveer86619/TrailStory/pkg/views"
+
+	"github.com/paulmach/orb/geojson"
 )
 
 type JourneyHandler struct {
@@ -35,8 +46,72 @@ func (h *JourneyHandler) Create(w http.ResponseWriter, r *http.Request) {
 	(&views.Success{StatusCode: 201, Data: journey, Message: "Journey created successfully"}).JSON(w)
 }
 
+func (h *JourneyHandler) Import(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+
+	// Track files can be large, but not unbounded
+	r.Body = http.MaxBytesReader(w, r.Body, 50<<20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "Invalid multipart form or file too large", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "Track file is required", err))
+		return
+	}
+	defer file.Close()
+
+	thin, _ := strconv.ParseFloat(r.FormValue("thin_m"), 64)
+	req := views.ImportJourneyRequest{
+		Title:      r.FormValue("title"),
+		IsPublic:   r.FormValue("is_public") == "true",
+		ThinMeters: thin,
+	}
+	if err := req.Valid(); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, err.Error(), nil))
+		return
+	}
+
+	var journey *views.JourneyView
+	switch strings.ToLower(filepath.Ext(header.Filename)) {
+	case ".gpx":
+		journey, err = h.Service.ImportGPX(userID, file, req)
+	case ".kml":
+		journey, err = h.Service.ImportKML(userID, file, req)
+	case ".kmz":
+		journey, err = h.Service.ImportKMZ(userID, file, req)
+	default:
+		err = errz.New(errz.BadRequest, "Unsupported file type, expected .gpx, .kml or .kmz", nil)
+	}
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 201, Data: journey, Message: "Journey imported successfully"}).JSON(w)
+}
+
 func (h *JourneyHandler) ListMine(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r)
+
+	opts, err := parseJourneyOptions(r)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+
+	if wantsGeoJSON(r) {
+		fc, err := h.Service.ListUserJourneysGeoJSON(userID, opts)
+		if err != nil {
+			errz.HandleErrors(w, err)
+			return
+		}
+		writeGeoJSON(w, fc)
+		return
+	}
+
 	journeys, err := h.Service.ListUserJourneys(userID)
 	if err != nil {
 		errz.HandleErrors(w, err)
@@ -49,7 +124,23 @@ func (h *JourneyHandler) Get(w http.ResponseWriter, r *http.Request) {
 	journeyID := r.PathValue("id")
 	userID := middleware.GetUserID(r)
 
-	journey, err := h.Service.GetJourney(journeyID, userID)
+	opts, err := parseJourneyOptions(r)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+
+	if wantsGeoJSON(r) {
+		fc, err := h.Service.GetJourneyGeoJSON(journeyID, userID, opts)
+		if err != nil {
+			errz.HandleErrors(w, err)
+			return
+		}
+		writeGeoJSON(w, fc)
+		return
+	}
+
+	journey, err := h.Service.GetJourney(journeyID, userID, opts)
 	if err != nil {
 		errz.HandleErrors(w, err)
 		return
@@ -57,6 +148,107 @@ func (h *JourneyHandler) Get(w http.ResponseWriter, r *http.Request) {
 	(&views.Success{StatusCode: 200, Data: journey, Message: "Journey fetched successfully"}).JSON(w)
 }
 
+func (h *JourneyHandler) ExportGPX(w http.ResponseWriter, r *http.Request) {
+	journeyID := r.PathValue("id")
+	userID := middleware.GetUserID(r)
+
+	// Buffer so that a failure can still be reported as a JSON error
+	var buf bytes.Buffer
+	if err := h.Service.ExportGPX(journeyID, userID, &buf); err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gpx+xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="journey-%s.gpx"`, journeyID))
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+func (h *JourneyHandler) ExportKML(w http.ResponseWriter, r *http.Request) {
+	journeyID := r.PathValue("id")
+	userID := middleware.GetUserID(r)
+
+	var buf bytes.Buffer
+	if err := h.Service.ExportKML(journeyID, userID, &buf); err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.google-earth.kml+xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="journey-%s.kml"`, journeyID))
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+func (h *JourneyHandler) Live(w http.ResponseWriter, r *http.Request) {
+	journeyID := r.PathValue("id")
+	userID := middleware.GetUserID(r)
+
+	sub, err := h.Service.SubscribeLive(journeyID, userID, r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	if sub.Cancel != nil {
+		defer sub.Cancel()
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	replayed := map[uint]bool{}
+	for _, ev := range sub.Replay {
+		if live.WriteEvent(w, ev) != nil {
+			return
+		}
+		replayed[ev.Seq] = true
+	}
+
+	if sub.Completed {
+		live.WriteEvent(w, live.Event{Name: live.EventCompleted, Data: map[string]string{"journey_id": journeyID}})
+		rc.Flush()
+		return
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			ev := live.Event{Name: live.EventHeartbeat, Data: map[string]string{"time": time.Now().UTC().Format(time.RFC3339)}}
+			if live.WriteEvent(w, ev) != nil || rc.Flush() != nil {
+				return
+			}
+		case ev, ok := <-sub.Events:
+			if !ok {
+				// Dropped for falling behind or closed for losing access; the
+				// client reconnects and resumes via Last-Event-ID
+				return
+			}
+			// Already sent as part of the replay
+			if ev.Seq != 0 && replayed[ev.Seq] {
+				continue
+			}
+			if live.WriteEvent(w, ev) != nil || rc.Flush() != nil {
+				return
+			}
+			if ev.Name == live.EventCompleted {
+				return
+			}
+		}
+	}
+}
+
 func (h *JourneyHandler) ListPublic(w http.ResponseWriter, r *http.Request) {
 	pageStr := r.URL.Query().Get("page")
 	limitStr := r.URL.Query().Get("limit")
@@ -71,6 +263,22 @@ func (h *JourneyHandler) ListPublic(w http.ResponseWriter, r *http.Request) {
 		limit = 10
 	}
 
+	opts, err := parseJourneyOptions(r)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+
+	if wantsGeoJSON(r) {
+		fc, err := h.Service.ListPublicJourneysGeoJSON(page, limit, opts)
+		if err != nil {
+			errz.HandleErrors(w, err)
+			return
+		}
+		writeGeoJSON(w, fc)
+		return
+	}
+
 	journeys, err := h.Service.ListPublicJourneys(page, limit)
 	if err != nil {
 		errz.HandleErrors(w, err)
@@ -84,6 +292,148 @@ func (h *JourneyHandler) ListPublic(w http.ResponseWriter, r *http.Request) {
 	}).JSON(w)
 }
 
+func (h *JourneyHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	journeyID := r.PathValue("id")
+
+	var req views.UpdateJourneyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "Invalid request", err))
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, err.Error(), nil))
+		return
+	}
+
+	journey, err := h.Service.UpdateJourney(userID, journeyID, req)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 200, Data: journey, Message: "Journey updated successfully"}).JSON(w)
+}
+
+func (h *JourneyHandler) Finish(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	journeyID := r.PathValue("id")
+
+	journey, err := h.Service.FinishJourney(userID, journeyID)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 200, Data: journey, Message: "Journey completed"}).JSON(w)
+}
+
+func (h *JourneyHandler) Reopen(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	journeyID := r.PathValue("id")
+
+	journey, err := h.Service.ReopenJourney(userID, journeyID)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 200, Data: journey, Message: "Journey reopened"}).JSON(w)
+}
+
+func (h *JourneyHandler) Nearby(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	q := r.URL.Query()
+
+	lat, latErr := strconv.ParseFloat(q.Get("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(q.Get("lng"), 64)
+	if latErr != nil || lngErr != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "lat and lng are required", nil))
+		return
+	}
+
+	radius := 5000.0
+	if v := q.Get("radius_m"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errz.HandleErrors(w, errz.New(errz.BadRequest, "Invalid radius_m", err))
+			return
+		}
+		radius = parsed
+	}
+
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > 50 {
+		limit = 20
+	}
+
+	req := views.NearbyRequest{Lat: lat, Lng: lng, RadiusM: radius, Limit: limit}
+	if err := req.Valid(); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, err.Error(), nil))
+		return
+	}
+
+	journeys, err := h.Service.FindNearbyJourneys(userID, req)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 200, Data: journeys, Message: "Nearby journeys fetched"}).JSON(w)
+}
+
+func (h *JourneyHandler) Viewport(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	q := r.URL.Query()
+
+	parts := strings.Split(q.Get("bbox"), ",")
+	if len(parts) != 4 {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "bbox must be minLng,minLat,maxLng,maxLat", nil))
+		return
+	}
+	var bbox [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			errz.HandleErrors(w, errz.New(errz.BadRequest, "bbox must be minLng,minLat,maxLng,maxLat", err))
+			return
+		}
+		bbox[i] = v
+	}
+
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > 2000 {
+		limit = 500
+	}
+
+	req := views.ViewportRequest{
+		MinLng: bbox[0],
+		MinLat: bbox[1],
+		MaxLng: bbox[2],
+		MaxLat: bbox[3],
+		Limit:  limit,
+	}
+
+	var err error
+	if req.From, err = parseTimeParam(q.Get("from")); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "from must be RFC3339", err))
+		return
+	}
+	if req.To, err = parseTimeParam(q.Get("to")); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "to must be RFC3339", err))
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, err.Error(), nil))
+		return
+	}
+
+	result, err := h.Service.FindInViewport(userID, req)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 200, Data: result, Message: "Viewport fetched"}).JSON(w)
+}
+
 func (h *JourneyHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r)
 	journeyID := r.PathValue("id")
@@ -113,6 +463,53 @@ func (h *JourneyHandler) AddCheckpoint(w http.ResponseWriter, r *http.Request) {
 	(&views.Success{StatusCode: 201, Data: cp, Message: "Checkpoint added successfully"}).JSON(w)
 }
 
+func (h *JourneyHandler) AddCheckpointsBatch(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	journeyID := r.PathValue("id")
+
+	r.Body = http.MaxBytesReader(w, r.Body, 5<<20)
+	var req views.BatchCheckpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "Invalid request", err))
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, err.Error(), nil))
+		return
+	}
+
+	result, err := h.Service.AddCheckpointsBatch(userID, journeyID, req)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 200, Data: result, Message: "Checkpoints synced"}).JSON(w)
+}
+
+func (h *JourneyHandler) UpdateCheckpoint(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	checkpointID := r.PathValue("id")
+
+	var req views.UpdateCheckpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "Invalid request", err))
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, err.Error(), nil))
+		return
+	}
+
+	cp, err := h.Service.UpdateCheckpoint(userID, checkpointID, req)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 200, Data: cp, Message: "Checkpoint updated successfully"}).JSON(w)
+}
+
 func (h *JourneyHandler) DeleteCheckpoint(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r)
 	checkpointID := r.PathValue("id")
@@ -123,3 +520,173 @@ func (h *JourneyHandler) DeleteCheckpoint(w http.ResponseWriter, r *http.Request
 	}
 	(&views.Success{StatusCode: 200, Message: "Checkpoint deleted"}).JSON(w)
 }
+
+func (h *JourneyHandler) UploadMedia(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	checkpointID := r.PathValue("id")
+
+	if err := parseUploadForm(w, r, upload.MediaPolicy); err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["media"]
+	if len(files) == 0 {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "Media file is required", nil))
+		return
+	}
+
+	cp, err := h.Service.UploadCheckpointMedia(userID, checkpointID, files)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 201, Data: cp, Message: "Media uploaded successfully"}).JSON(w)
+}
+
+func (h *JourneyHandler) CreateMediaUpload(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	checkpointID := r.PathValue("id")
+
+	var req views.MediaUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "Invalid request", err))
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, err.Error(), nil))
+		return
+	}
+
+	target, err := h.Service.CreateMediaUpload(userID, checkpointID, req)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 201, Data: target, Message: "Upload URL created"}).JSON(w)
+}
+
+func (h *JourneyHandler) CompleteMediaUpload(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	checkpointID := r.PathValue("id")
+
+	var req views.CompleteMediaUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "Invalid request", err))
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, err.Error(), nil))
+		return
+	}
+
+	cp, err := h.Service.CompleteMediaUpload(userID, checkpointID, req)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 201, Data: cp, Message: "Media uploaded successfully"}).JSON(w)
+}
+
+func (h *JourneyHandler) ImportPhotos(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	journeyID := r.PathValue("id")
+
+	if err := parseUploadForm(w, r, upload.PhotoPolicy); err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["photos"]
+	if len(files) == 0 {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "At least one photo is required", nil))
+		return
+	}
+	if len(files) > views.MaxPhotoImport {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, fmt.Sprintf("Cannot import more than %d photos at once", views.MaxPhotoImport), nil))
+		return
+	}
+
+	result, err := h.Service.ImportPhotos(userID, journeyID, files)
+	if err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	(&views.Success{StatusCode: 200, Data: result, Message: "Photos imported"}).JSON(w)
+}
+
+// parseUploadForm caps the request body at the policy's limit before parsing,
+// so an oversized upload is cut off while streaming instead of filling the disk.
+func parseUploadForm(w http.ResponseWriter, r *http.Request, policy upload.Policy) error {
+	r.Body = http.MaxBytesReader(w, r.Body, policy.MaxRequest)
+
+	// Files beyond 32MB spill over to temp files on disk
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return errz.New(errz.PayloadTooLarge, fmt.Sprintf("Upload is larger than %d MB", policy.MaxRequest>>20), err)
+		}
+		return errz.New(errz.BadRequest, "Invalid multipart form", err)
+	}
+	return nil
+}
+
+// parseJourneyOptions reads ?simplify=<meters> or ?zoom=<0-22>. A zoom level
+// is turned into a tolerance of roughly one screen pixel at that zoom.
+func parseJourneyOptions(r *http.Request) (views.JourneyOptions, error) {
+	var opts views.JourneyOptions
+	q := r.URL.Query()
+
+	if v := q.Get("simplify"); v != "" {
+		tolerance, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, errz.New(errz.BadRequest, "simplify must be a tolerance in meters", err)
+		}
+		opts.SimplifyM = tolerance
+	} else if v := q.Get("zoom"); v != "" {
+		zoom, err := strconv.Atoi(v)
+		if err != nil || zoom < 0 || zoom > 22 {
+			return opts, errz.New(errz.BadRequest, "zoom must be an integer between 0 and 22", err)
+		}
+		// Web Mercator meters per pixel at the equator
+		opts.SimplifyM = 156543.03 / math.Pow(2, float64(zoom))
+	}
+
+	if err := opts.Valid(); err != nil {
+		return opts, errz.New(errz.BadRequest, err.Error(), nil)
+	}
+	return opts, nil
+}
+
+// wantsGeoJSON reports whether the client asked for GeoJSON via the Accept
+// header or ?format=geojson.
+func wantsGeoJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "geojson" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), views.GeoJSONContentType)
+}
+
+// writeGeoJSON writes a bare FeatureCollection, without the Success envelope,
+// so it can be fed directly to map libraries.
+func writeGeoJSON(w http.ResponseWriter, fc *geojson.FeatureCollection) {
+	w.Header().Set("Content-Type", views.GeoJSONContentType)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(fc)
+}
+
+// parseTimeParam parses an optional RFC3339 query value; empty yields nil.
+func parseTimeParam(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
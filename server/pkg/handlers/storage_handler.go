@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+)
+
+// StorageHandler serves files and receives direct uploads for the local
+// storage driver, which has no storage service of its own to do so.
+type StorageHandler struct {
+	Storage  *storage.LocalStorage
+	IsPublic func(storageKey string) bool // Files served without a signature
+	files    http.Handler
+}
+
+func NewStorageHandler(local *storage.LocalStorage, root string, isPublic func(storageKey string) bool) *StorageHandler {
+	return &StorageHandler{
+		Storage:  local,
+		IsPublic: isPublic,
+		files:    http.StripPrefix("/static/", http.FileServer(filesOnly{http.Dir(root)})),
+	}
+}
+
+// filesOnly hides directories, so /static/ never lists a folder's files.
+type filesOnly struct {
+	http.FileSystem
+}
+
+func (f filesOnly) Open(name string) (http.File, error) {
+	file, err := f.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, fs.ErrNotExist
+	}
+	return file, nil
+}
+
+// Serve hands out files under /static/. Anything not public, such as the
+// media of private journeys, needs a signed URL that has not expired.
+func (h *StorageHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(path.Clean(r.URL.Path), "/static/")
+
+	if !h.IsPublic(key) {
+		if err := h.Storage.VerifyURL(key, r.URL.Query()); err != nil {
+			errz.HandleErrors(w, errz.New(errz.Forbidden, "Invalid or expired media URL", err))
+			return
+		}
+	}
+
+	h.files.ServeHTTP(w, r)
+}
+
+func (h *StorageHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	signed, err := h.Storage.VerifyUpload(r.URL.Query())
+	if err != nil {
+		errz.HandleErrors(w, errz.New(errz.Forbidden, "Invalid or expired upload URL", err))
+		return
+	}
+
+	if r.Header.Get("Content-Type") != signed.ContentType {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "Content-Type does not match the upload URL", nil))
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, signed.Size)
+	if err := h.Storage.Create(signed.Key, body, signed.Size); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr), errors.Is(err, storage.ErrSizeMismatch):
+			errz.HandleErrors(w, errz.New(errz.BadRequest, "Upload size does not match the upload URL", err))
+		case errors.Is(err, storage.ErrExists):
+			errz.HandleErrors(w, errz.New(errz.Conflict, "This upload URL was already used", err))
+		default:
+			errz.HandleErrors(w, errz.New(errz.InternalServerError, "Failed to store upload", err))
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/Mahaveer86619/TrailStory/pkg/errz"
 	"github.com/Mahaveer86619/TrailStory/pkg/middleware"
 	"github.com/Mahaveer86619/TrailStory/pkg/services"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/upload"
 	"github.com/Mahaveer86619/TrailStory/pkg/utils"
 	"github.com/Mahaveer86619/TrailStory/pkg/views"
 )
@@ -76,7 +77,7 @@ func (h *UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 
 func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r)
-	user, err := h.Service.GetUser(userID)
+	user, err := h.Service.GetMe(userID)
 	if err != nil {
 		errz.HandleErrors(w, err)
 		return
@@ -103,17 +104,30 @@ func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r)
 
-	// Limit upload size (e.g., 5MB)
-	r.ParseMultipartForm(5 << 20)
+	if err := parseUploadForm(w, r, upload.AvatarPolicy); err != nil {
+		errz.HandleErrors(w, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["image"]
+	if len(files) == 0 {
+		errz.HandleErrors(w, errz.New(errz.BadRequest, "Image file is required", nil))
+		return
+	}
 
-	file, header, err := r.FormFile("image")
+	user, err := h.Service.UploadProfilePic(userID, files[0])
 	if err != nil {
-		errz.HandleErrors(w, errz.New(errz.BadRequest, "Image file is required", err))
+		errz.HandleErrors(w, err)
 		return
 	}
-	defer file.Close()
+	(&views.Success{StatusCode: 200, Data: user}).JSON(w)
+}
+
+func (h *UserHandler) RemoveAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
 
-	user, err := h.Service.UploadProfilePic(userID, header.Filename, file)
+	user, err := h.Service.RemoveProfilePic(userID)
 	if err != nil {
 		errz.HandleErrors(w, err)
 		return
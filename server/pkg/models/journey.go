@@ -80,8 +80,31 @@ type Checkpoint struct {
 	gorm.Model
 
 	JourneyID uint
+	ClientID  *string  // Set by offline clients to deduplicate retried uploads
 	Location  GeoPoint `gorm:"type:geometry(Point, 4326)"`
 	Timestamp time.Time
 	Note      string
+	Place     Place   `gorm:"embedded;embeddedPrefix:place_"`
 	Media     []Media `gorm:"foreignKey:CheckpointID;constraint:OnDelete:CASCADE;"`
 }
+
+// Place is the reverse-geocoded name of a checkpoint's location. Empty until
+// the geocoder has resolved it.
+type Place struct {
+	Locality    string
+	Region      string
+	Country     string
+	CountryCode string
+}
+
+// Name is the most specific part of the place that is known.
+func (p Place) Name() string {
+	switch {
+	case p.Locality != "":
+		return p.Locality
+	case p.Region != "":
+		return p.Region
+	default:
+		return p.Country
+	}
+}
@@ -8,6 +8,18 @@ type Media struct {
 	gorm.Model
 
 	CheckpointID uint
-	URL          string `gorm:"not null"`
-	Type         string // image, video
+	URL          string `gorm:"not null"` // Storage key
+	Filename     string // As uploaded; never used to build the key
+	Type         string // upload.KindImage or upload.KindVideo
+	ContentType  string // Sniffed from the bytes, not taken from the client
+	SizeBytes    int64
+	Variants     ImageVariants `gorm:"embedded;embeddedPrefix:url_"`
+}
+
+// ImageVariants holds the storage keys of the resized copies of an image.
+// Empty for videos and for images uploaded before variants existed.
+type ImageVariants struct {
+	Thumb  string
+	Medium string
+	Full   string
 }
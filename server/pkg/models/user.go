@@ -9,10 +9,12 @@ import (
 type User struct {
 	gorm.Model
 
-	DisplayName  string
-	Email        string
-	ProfilePic   string
-	PasswordHash string
+	DisplayName        string
+	Email              string
+	ProfilePic         string
+	ProfilePicVariants ImageVariants `gorm:"embedded;embeddedPrefix:profile_pic_"`
+	ProfilePicSize     int64         // Counted towards the storage quota
+	PasswordHash       string
 }
 
 type Following struct {
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/utils"
+	"github.com/Mahaveer86619/TrailStory/pkg/views"
+
+	"github.com/paulmach/orb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AddCheckpointsBatch stores many checkpoints in one transaction. Items are
+// keyed by their client_id: a client_id already stored for this journey (or
+// repeated within the batch) is reported as a duplicate instead of inserted,
+// so a client can safely resend a batch after a network failure.
+func (s *JourneyService) AddCheckpointsBatch(userID uint, journeyMaskedID string, req views.BatchCheckpointRequest) (*views.BatchCheckpointView, error) {
+	journeyID, err := utils.UnmaskID(journeyMaskedID)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid Journey ID", err)
+	}
+
+	if _, err := s.findOwnedJourney(userID, journeyID); err != nil {
+		return nil, err
+	}
+
+	results := make([]views.BatchItemResult, len(req.Checkpoints))
+	pending := map[string]*models.Checkpoint{}
+	var order []string
+
+	for i, item := range req.Checkpoints {
+		results[i].ClientID = item.ClientID
+
+		if err := item.Valid(); err != nil {
+			results[i].Status = views.BatchStatusInvalid
+			results[i].Error = err.Error()
+			continue
+		}
+		if _, seen := pending[item.ClientID]; seen {
+			continue
+		}
+
+		ts := time.Now()
+		if item.Timestamp != "" {
+			ts, _ = time.Parse(time.RFC3339, item.Timestamp)
+		}
+
+		clientID := item.ClientID
+		pending[clientID] = &models.Checkpoint{
+			JourneyID: journeyID,
+			ClientID:  &clientID,
+			Location:  models.GeoPoint{Point: orb.Point{item.Lng, item.Lat}},
+			Note:      item.Note,
+			Timestamp: ts,
+		}
+		order = append(order, clientID)
+	}
+
+	created := map[string]bool{}
+	stored := map[string]uint{}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if len(order) == 0 {
+			return nil
+		}
+
+		// Serialize syncs of the same journey so concurrent retries of a batch
+		// cannot both miss the lookup below and insert the same client_id
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").First(&models.Journey{}, journeyID).Error; err != nil {
+			return err
+		}
+
+		if err := s.lookupClientIDs(tx, journeyID, order, stored); err != nil {
+			return err
+		}
+
+		toInsert := make([]*models.Checkpoint, 0, len(order))
+		for _, clientID := range order {
+			if _, ok := stored[clientID]; !ok {
+				toInsert = append(toInsert, pending[clientID])
+			}
+		}
+		if len(toInsert) == 0 {
+			return nil
+		}
+
+		if err := tx.CreateInBatches(toInsert, 500).Error; err != nil {
+			return err
+		}
+
+		for _, cp := range toInsert {
+			created[*cp.ClientID] = true
+			stored[*cp.ClientID] = cp.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to store checkpoints", err)
+	}
+
+	var inserted []models.Checkpoint
+	for _, clientID := range order {
+		if created[clientID] {
+			s.publishCheckpoint(pending[clientID])
+			inserted = append(inserted, *pending[clientID])
+		}
+	}
+	s.resolvePlacesAsync(inserted)
+
+	resp := &views.BatchCheckpointView{Results: results}
+	for i := range results {
+		if results[i].Status == "" {
+			clientID := results[i].ClientID
+			results[i].ID = utils.MaskID(stored[clientID])
+			if created[clientID] {
+				results[i].Status = views.BatchStatusCreated
+				created[clientID] = false // Later repeats in the batch are duplicates
+			} else {
+				results[i].Status = views.BatchStatusDuplicate
+			}
+		}
+
+		switch results[i].Status {
+		case views.BatchStatusCreated:
+			resp.Created++
+		case views.BatchStatusDuplicate:
+			resp.Duplicates++
+		case views.BatchStatusInvalid:
+			resp.Invalid++
+		}
+	}
+
+	return resp, nil
+}
+
+// lookupClientIDs records the checkpoint ID of every client ID already stored
+// for the journey. Soft-deleted rows count too, so a late retry does not bring
+// back a checkpoint the user has since deleted.
+func (s *JourneyService) lookupClientIDs(tx *gorm.DB, journeyID uint, clientIDs []string, into map[string]uint) error {
+	var existing []models.Checkpoint
+	err := tx.Unscoped().Select("id", "client_id").
+		Where("journey_id = ? AND client_id IN ?", journeyID, clientIDs).
+		Find(&existing).Error
+	if err != nil {
+		return err
+	}
+
+	for _, cp := range existing {
+		into[*cp.ClientID] = cp.ID
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/db"
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+
+	"gorm.io/gorm"
+)
+
+// storedKeys lists an original and whichever of its variants exist.
+func storedKeys(original string, v models.ImageVariants) []string {
+	var keys []string
+	for _, key := range []string{original, v.Thumb, v.Medium, v.Full} {
+		if key != "" && !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// deleteStored removes files whose rows are gone. Failures are only logged:
+// the garbage collector picks up whatever is left behind.
+func deleteStored(store storage.StorageService, keys []string) {
+	for _, key := range keys {
+		if err := store.Delete(key); err != nil {
+			log.Printf("Failed to delete %s: %v", key, err)
+		}
+	}
+}
+
+// checkpointMediaKeys lists the stored files of the live media matched by
+// where.
+func checkpointMediaKeys(tx *gorm.DB, where string, args ...interface{}) ([]string, error) {
+	var media []models.Media
+	err := tx.Joins("JOIN checkpoints ON checkpoints.id = media.checkpoint_id").
+		Where(where, args...).
+		Find(&media).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, m := range media {
+		keys = append(keys, storedKeys(m.URL, m.Variants)...)
+	}
+	return keys, nil
+}
+
+type GCReport struct {
+	Scanned    int
+	Orphans    int
+	Deleted    int
+	FreedBytes int64
+}
+
+// StorageGC removes stored files that no row refers to.
+type StorageGC struct {
+	DB      *gorm.DB
+	Storage storage.StorageService
+}
+
+func NewStorageGC(storage storage.StorageService) *StorageGC {
+	return &StorageGC{
+		DB:      db.GetTrailStoryDB().DB,
+		Storage: storage,
+	}
+}
+
+// Run deletes orphans older than grace. Younger files are kept because
+// uploads are stored before their row is written, and direct uploads stay
+// unreferenced until completed. With dryRun, orphans are only reported.
+//
+// Only the folders in storage.Prefixes are scanned, so objects other
+// applications keep in a shared bucket are never touched.
+func (g *StorageGC) Run(grace time.Duration, dryRun bool) (*GCReport, error) {
+	refs, err := referencedKeys(g.DB)
+	if err != nil {
+		return nil, err
+	}
+	return g.sweep(refs, time.Now().Add(-grace), dryRun)
+}
+
+// sweep deletes the objects under storage.Prefixes that are not in refs and
+// were last modified before cutoff.
+func (g *StorageGC) sweep(refs map[string]bool, cutoff time.Time, dryRun bool) (*GCReport, error) {
+	// Collect first; deleting while listing could skip objects
+	report := &GCReport{}
+	var orphans []storage.ObjectInfo
+	for _, prefix := range storage.Prefixes {
+		err := g.Storage.List(prefix, func(obj storage.ObjectInfo) error {
+			report.Scanned++
+			if !refs[obj.Key] && obj.ModTime.Before(cutoff) {
+				orphans = append(orphans, obj)
+			}
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+	report.Orphans = len(orphans)
+
+	for _, obj := range orphans {
+		if dryRun {
+			log.Printf("Orphan %s (%d bytes, %s)", obj.Key, obj.Size, obj.ModTime.Format(time.RFC3339))
+			continue
+		}
+		if err := g.Storage.Delete(obj.Key); err != nil {
+			log.Printf("Failed to delete %s: %v", obj.Key, err)
+			continue
+		}
+		report.Deleted++
+		report.FreedBytes += obj.Size
+	}
+	return report, nil
+}
+
+// referencedKeys collects every key used by live media and avatars. Media of
+// deleted checkpoints and journeys no longer count.
+func referencedKeys(database *gorm.DB) (map[string]bool, error) {
+	refs := map[string]bool{}
+
+	var media []models.Media
+	err := database.Select("media.id, media.url, media.url_thumb, media.url_medium, media.url_full").
+		Joins("JOIN checkpoints ON checkpoints.id = media.checkpoint_id AND checkpoints.deleted_at IS NULL").
+		Joins("JOIN journeys ON journeys.id = checkpoints.journey_id AND journeys.deleted_at IS NULL").
+		FindInBatches(&media, backfillPageSize, func(tx *gorm.DB, batch int) error {
+			for _, m := range media {
+				for _, key := range storedKeys(m.URL, m.Variants) {
+					refs[key] = true
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	err = database.Select("id, profile_pic, profile_pic_thumb, profile_pic_medium, profile_pic_full").
+		Where("profile_pic <> ''").
+		FindInBatches(&users, backfillPageSize, func(tx *gorm.DB, batch int) error {
+			for _, u := range users {
+				for _, key := range storedKeys(u.ProfilePic, u.ProfilePicVariants) {
+					refs[key] = true
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
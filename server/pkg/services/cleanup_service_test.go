@@ -0,0 +1,94 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+)
+
+func TestStorageGCSweep(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+	cutoff := time.Now().Add(-24 * time.Hour)
+
+	objects := []struct {
+		key      string
+		modTime  time.Time
+		wantKept bool
+	}{
+		{"journeys/1/checkpoints/2/referenced.jpg", old, true},
+		{"journeys/1/checkpoints/2/orphan.jpg", old, false},
+		{"journeys/1/upload_pending.jpg", time.Now(), true}, // Within the grace period
+		{"users/3/referenced.jpg", old, true},
+		{"users/3/orphan.jpg", old, false},
+		{"media/ab/abcdef.jpg", old, false},
+		{"backups/db.sql", old, true}, // Outside storage.Prefixes
+		{"journeys.txt", old, true},
+		{"other-app/journeys/1/photo.jpg", old, true},
+	}
+	refs := map[string]bool{
+		"journeys/1/checkpoints/2/referenced.jpg": true,
+		"users/3/referenced.jpg":                  true,
+	}
+
+	setup := func(t *testing.T) (*StorageGC, string) {
+		dir := t.TempDir()
+		store := storage.NewLocalStorage(dir, "secret")
+		for _, obj := range objects {
+			if err := store.Put(obj.key, strings.NewReader("data"), 4); err != nil {
+				t.Fatalf("Put(%s): %v", obj.key, err)
+			}
+			if err := os.Chtimes(filepath.Join(dir, obj.key), obj.modTime, obj.modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return &StorageGC{Storage: store}, dir
+	}
+
+	t.Run("deletes old orphans under the app's prefixes only", func(t *testing.T) {
+		gc, dir := setup(t)
+		report, err := gc.sweep(refs, cutoff, false)
+		if err != nil {
+			t.Fatalf("sweep: %v", err)
+		}
+
+		for _, obj := range objects {
+			_, err := os.Stat(filepath.Join(dir, obj.key))
+			if kept := !errors.Is(err, os.ErrNotExist); kept != obj.wantKept {
+				t.Errorf("%s kept = %v, want %v", obj.key, kept, obj.wantKept)
+			}
+		}
+		if report.Scanned != 6 || report.Orphans != 3 || report.Deleted != 3 || report.FreedBytes != 12 {
+			t.Errorf("report = %+v, want 6 scanned and 3 orphans deleted", report)
+		}
+	})
+
+	t.Run("dry run deletes nothing", func(t *testing.T) {
+		gc, dir := setup(t)
+		report, err := gc.sweep(refs, cutoff, true)
+		if err != nil {
+			t.Fatalf("sweep: %v", err)
+		}
+
+		for _, obj := range objects {
+			if _, err := os.Stat(filepath.Join(dir, obj.key)); err != nil {
+				t.Errorf("%s: %v", obj.key, err)
+			}
+		}
+		if report.Orphans != 3 || report.Deleted != 0 || report.FreedBytes != 0 {
+			t.Errorf("report = %+v, want 3 orphans and nothing deleted", report)
+		}
+	})
+}
+
+func TestStoredKeys(t *testing.T) {
+	keys := storedKeys("a.jpg", models.ImageVariants{Thumb: "a_thumb.jpg", Full: "a.jpg"})
+	if len(keys) != 2 || keys[0] != "a.jpg" || keys[1] != "a_thumb.jpg" {
+		t.Errorf("storedKeys = %q, want the original once and the existing variants", keys)
+	}
+}
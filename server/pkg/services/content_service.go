@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/upload"
+
+	"gorm.io/gorm"
+)
+
+// Objects under a content key younger than this are left to the garbage
+// collector rather than released: an upload may have just written them and
+// not yet recorded its row.
+const contentReleaseGrace = time.Hour
+
+// storeContent saves an upload under the SHA-256 of its bytes. When the same
+// image is already stored, the variants of a live row are reused instead of
+// rendered again.
+//
+// Shared objects are reference counted by the media rows themselves: every
+// row naming a key is a reference, and releaseMedia only deletes keys that
+// no live row names any more. Rows stored under the per-checkpoint layout
+// are simply objects with a single reference.
+//
+// Storing and releasing the same content are serialized by a lock on its
+// hash. Every object is written again even when it exists, which refreshes
+// its age, so a release racing this upload leaves it alone.
+func (s *JourneyService) storeContent(checkpointID uint, filename string, file *upload.File, data []byte) (*models.Media, error) {
+	body, sum, cleanup, err := hashUpload(file, data)
+	if err != nil {
+		return nil, uploadError(filename, err)
+	}
+	defer cleanup()
+
+	name := "original" + file.Ext()
+	key := storage.ContentKey(sum, name)
+	media := &models.Media{
+		CheckpointID: checkpointID,
+		URL:          key,
+		Filename:     uploadedName(filename),
+		Type:         file.Kind,
+		ContentType:  file.ContentType,
+		SizeBytes:    file.Size(),
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockContent(tx, sum); err != nil {
+			return err
+		}
+		if err := s.Storage.Put(key, body, file.Size()); err != nil {
+			return err
+		}
+		if data == nil {
+			return nil
+		}
+
+		if variants, ok := s.reuseVariants(tx, key); ok {
+			media.Variants = variants
+			return nil
+		}
+		media.Variants, err = saveVariants(data, name, func(variant string, r io.Reader) (string, error) {
+			content, err := io.ReadAll(r)
+			if err != nil {
+				return "", err
+			}
+			variantKey := storage.ContentKey(sum, variant)
+			return variantKey, s.Storage.Put(variantKey, bytes.NewReader(content), int64(len(content)))
+		})
+		return err
+	})
+	if err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to save media", err)
+	}
+	return media, nil
+}
+
+// reuseVariants finds the variants of a live row with the same original and
+// writes them again. Reports false when there are none or any is gone.
+func (s *JourneyService) reuseVariants(tx *gorm.DB, key string) (models.ImageVariants, bool) {
+	var existing models.Media
+	err := tx.Joins("JOIN checkpoints ON checkpoints.id = media.checkpoint_id AND checkpoints.deleted_at IS NULL").
+		Joins("JOIN journeys ON journeys.id = checkpoints.journey_id AND journeys.deleted_at IS NULL").
+		Where("media.url = ? AND media.url_thumb <> ''", key).
+		First(&existing).Error
+	if err != nil {
+		return models.ImageVariants{}, false
+	}
+
+	for _, variantKey := range storedKeys("", existing.Variants) {
+		if err := s.rewrite(variantKey); err != nil {
+			return models.ImageVariants{}, false
+		}
+	}
+	return existing.Variants, true
+}
+
+// rewrite stores an object again under its own key.
+func (s *JourneyService) rewrite(key string) error {
+	stored, err := s.Storage.Open(key)
+	if err != nil {
+		return err
+	}
+	defer stored.Close()
+
+	content, err := io.ReadAll(stored)
+	if err != nil {
+		return err
+	}
+	return s.Storage.Put(key, bytes.NewReader(content), int64(len(content)))
+}
+
+// lockContent holds the lock on a content hash until tx ends.
+func lockContent(tx *gorm.DB, sum string) error {
+	id, err := strconv.ParseUint(sum[:16], 16, 64)
+	if err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", int64(id)).Error
+}
+
+// hashUpload reads an upload to the end to hash it. Images are already in
+// memory; anything else is spooled to a temporary file, removed by cleanup.
+func hashUpload(file *upload.File, data []byte) (io.Reader, string, func(), error) {
+	if data != nil {
+		sum := sha256.Sum256(data)
+		return bytes.NewReader(data), hex.EncodeToString(sum[:]), func() {}, nil
+	}
+
+	tmp, err := os.CreateTemp("", "trailstory-upload-*")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(tmp, io.TeeReader(file, hash)); err != nil {
+		cleanup()
+		return nil, "", nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, "", nil, err
+	}
+	return tmp, hex.EncodeToString(hash.Sum(nil)), cleanup, nil
+}
+
+// releaseMedia deletes the stored files of deleted media, except those that
+// other live rows still refer to.
+func (s *JourneyService) releaseMedia(keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	// Shared content is released per hash, under the lock storeContent takes
+	var own []string
+	shared := map[string][]string{}
+	for _, key := range keys {
+		if sum, ok := storage.ContentSum(key); ok {
+			shared[sum] = append(shared[sum], key)
+		} else {
+			own = append(own, key)
+		}
+	}
+
+	if err := s.releaseKeys(s.DB, own, false); err != nil {
+		// Keep everything; the garbage collector can decide later
+		log.Printf("Failed to count references of deleted media: %v", err)
+	}
+	for sum, keys := range shared {
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			if err := lockContent(tx, sum); err != nil {
+				return err
+			}
+			return s.releaseKeys(tx, keys, true)
+		})
+		if err != nil {
+			log.Printf("Failed to release shared media %s: %v", sum, err)
+		}
+	}
+}
+
+// releaseKeys deletes those of keys no live row refers to. With keepFresh,
+// objects written within contentReleaseGrace are kept too.
+func (s *JourneyService) releaseKeys(tx *gorm.DB, keys []string, keepFresh bool) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	inUse, err := keysInUse(tx, keys)
+	if err != nil {
+		return err
+	}
+
+	var unused []string
+	for _, key := range keys {
+		if inUse[key] {
+			continue
+		}
+		if keepFresh {
+			info, err := s.Storage.Stat(key)
+			if err != nil || time.Since(info.ModTime) < contentReleaseGrace {
+				continue
+			}
+		}
+		unused = append(unused, key)
+	}
+	deleteStored(s.Storage, unused)
+	return nil
+}
+
+// keysInUse reports which of keys live media rows refer to.
+func keysInUse(database *gorm.DB, keys []string) (map[string]bool, error) {
+	var media []models.Media
+	err := database.Select("media.url, media.url_thumb, media.url_medium, media.url_full").
+		Joins("JOIN checkpoints ON checkpoints.id = media.checkpoint_id AND checkpoints.deleted_at IS NULL").
+		Joins("JOIN journeys ON journeys.id = checkpoints.journey_id AND journeys.deleted_at IS NULL").
+		Where("media.url IN ? OR media.url_thumb IN ? OR media.url_medium IN ? OR media.url_full IN ?", keys, keys, keys, keys).
+		Find(&media).Error
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := map[string]bool{}
+	for _, m := range media {
+		for _, key := range storedKeys(m.URL, m.Variants) {
+			inUse[key] = true
+		}
+	}
+	return inUse, nil
+}
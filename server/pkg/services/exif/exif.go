@@ -0,0 +1,391 @@
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+)
+
+/*
+
+Supported subset of EXIF ->
+
+JPEG: APP1 segment starting with "Exif\0\0"
+PNG:  eXIf chunk
+
+IFD0       Orientation (0x0112), DateTime (0x0132), Exif IFD (0x8769), GPS IFD (0x8825)
+Exif IFD   DateTimeOriginal (0x9003), OffsetTime (0x9010), OffsetTimeOriginal (0x9011)
+GPS IFD    Lat/Lng and refs (0x01-0x04), GPSTimeStamp (0x07), GPSDateStamp (0x1D)
+
+*/
+
+// ErrNoExif is returned for images that carry no EXIF block at all.
+var ErrNoExif = errors.New("no EXIF data")
+
+// An APP1 segment cannot exceed 64KB; eXIf chunks get the same generous cap.
+const maxExifSize = 1 << 20
+
+const (
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTime         = 0x9010
+	tagOffsetTimeOriginal = 0x9011
+
+	tagGPSLatitudeRef  = 0x01
+	tagGPSLatitude     = 0x02
+	tagGPSLongitudeRef = 0x03
+	tagGPSLongitude    = 0x04
+	tagGPSTimeStamp    = 0x07
+	tagGPSDateStamp    = 0x1D
+)
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+type Info struct {
+	Location *orb.Point // nil when the photo has no usable GPS fix
+	Time     time.Time  // Zero when the photo has no capture time
+
+	// HasZone is false when Time is a camera wall-clock reading without an
+	// offset. It is then returned in UTC and should be re-read in the zone
+	// of the photo's location.
+	HasZone bool
+
+	// Orientation is the TIFF orientation (1-8) the image must be turned by
+	// to display upright. 1 when not recorded.
+	Orientation int
+}
+
+// Decode reads the EXIF block of a JPEG or PNG image.
+func Decode(r io.Reader) (*Info, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(8)
+	if err != nil {
+		return nil, fmt.Errorf("reading image header: %w", err)
+	}
+
+	var tiff []byte
+	switch {
+	case head[0] == 0xFF && head[1] == 0xD8:
+		tiff, err = jpegExif(br)
+	case bytes.Equal(head, []byte("\x89PNG\r\n\x1a\n")):
+		tiff, err = pngExif(br)
+	default:
+		return nil, errors.New("not a JPEG or PNG image")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tiff == nil {
+		return nil, ErrNoExif
+	}
+
+	return parseTIFF(tiff)
+}
+
+func jpegExif(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(2); err != nil {
+		return nil, err
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("reading JPEG marker: %w", err)
+		}
+		if b != 0xFF {
+			return nil, errors.New("malformed JPEG marker")
+		}
+
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xFF { // Fill bytes
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading JPEG marker: %w", err)
+		}
+
+		switch {
+		case marker == 0xDA || marker == 0xD9: // Image data starts; metadata is over
+			return nil, nil
+		case marker >= 0xD0 && marker <= 0xD7, marker == 0x01: // No length
+			continue
+		}
+
+		var size uint16
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, fmt.Errorf("reading JPEG segment: %w", err)
+		}
+		if size < 2 {
+			return nil, errors.New("malformed JPEG segment")
+		}
+
+		if marker != 0xE1 {
+			if _, err := r.Discard(int(size) - 2); err != nil {
+				return nil, fmt.Errorf("reading JPEG segment: %w", err)
+			}
+			continue
+		}
+
+		data := make([]byte, int(size)-2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("reading JPEG segment: %w", err)
+		}
+		// APP1 is also used for XMP; keep looking in that case
+		if bytes.HasPrefix(data, []byte("Exif\x00\x00")) {
+			return data[6:], nil
+		}
+	}
+}
+
+func pngExif(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(8); err != nil {
+		return nil, err
+	}
+
+	for {
+		var header struct {
+			Length uint32
+			Type   [4]byte
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("reading PNG chunk: %w", err)
+		}
+
+		switch string(header.Type[:]) {
+		case "IEND":
+			return nil, nil
+		case "eXIf":
+			if header.Length > maxExifSize {
+				return nil, errors.New("PNG eXIf chunk is too large")
+			}
+			data := make([]byte, header.Length)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, fmt.Errorf("reading PNG chunk: %w", err)
+			}
+			return data, nil
+		}
+
+		// Skip the data and the CRC
+		if _, err := io.CopyN(io.Discard, r, int64(header.Length)+4); err != nil {
+			return nil, fmt.Errorf("reading PNG chunk: %w", err)
+		}
+	}
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// Sizes of the TIFF field types we may meet, by type code.
+var typeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func parseTIFF(data []byte) (*Info, error) {
+	if len(data) < 8 {
+		return nil, errors.New("EXIF block is truncated")
+	}
+
+	t := &tiffReader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, errors.New("EXIF block has an invalid byte order")
+	}
+	if t.order.Uint16(data[2:]) != 42 {
+		return nil, errors.New("EXIF block has an invalid TIFF header")
+	}
+
+	ifd0, err := t.readIFD(t.order.Uint32(data[4:]))
+	if err != nil {
+		return nil, err
+	}
+
+	exifIFD := map[uint16]ifdEntry{}
+	if offset, ok := t.uint32(ifd0[tagExifIFD]); ok {
+		if exifIFD, err = t.readIFD(offset); err != nil {
+			return nil, err
+		}
+	}
+
+	gpsIFD := map[uint16]ifdEntry{}
+	if offset, ok := t.uint32(ifd0[tagGPSIFD]); ok {
+		if gpsIFD, err = t.readIFD(offset); err != nil {
+			return nil, err
+		}
+	}
+
+	info := &Info{Location: t.location(gpsIFD), Orientation: 1}
+	if o, ok := t.uint32(ifd0[tagOrientation]); ok && o >= 1 && o <= 8 {
+		info.Orientation = int(o)
+	}
+
+	// Most to least trustworthy: the camera's clock with its offset, the GPS
+	// clock (always UTC), then the camera's clock on its own
+	original, originalZone := t.ascii(exifIFD[tagDateTimeOriginal]), t.ascii(exifIFD[tagOffsetTimeOriginal])
+	modified, modifiedZone := t.ascii(ifd0[tagDateTime]), t.ascii(exifIFD[tagOffsetTime])
+
+	if ts, ok := parseTime(original, originalZone); ok && originalZone != "" {
+		info.Time, info.HasZone = ts, true
+	} else if ts, ok := t.gpsTime(gpsIFD); ok {
+		info.Time, info.HasZone = ts, true
+	} else if ts, ok := parseTime(original, ""); ok {
+		info.Time = ts
+	} else if ts, ok := parseTime(modified, modifiedZone); ok {
+		info.Time, info.HasZone = ts, modifiedZone != ""
+	}
+
+	return info, nil
+}
+
+func (t *tiffReader) readIFD(offset uint32) (map[uint16]ifdEntry, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, errors.New("EXIF directory is out of bounds")
+	}
+
+	count := uint32(t.order.Uint16(t.data[offset:]))
+	start := offset + 2
+	if uint64(start)+uint64(count)*12 > uint64(len(t.data)) {
+		return nil, errors.New("EXIF directory is truncated")
+	}
+
+	entries := make(map[uint16]ifdEntry, count)
+	for i := uint32(0); i < count; i++ {
+		raw := t.data[start+i*12 : start+i*12+12]
+		tag := t.order.Uint16(raw)
+		typ := t.order.Uint16(raw[2:])
+		n := t.order.Uint32(raw[4:])
+
+		size, known := typeSizes[typ]
+		if !known {
+			continue
+		}
+		total := uint64(size) * uint64(n)
+
+		var value []byte
+		if total <= 4 {
+			value = raw[8 : 8+total]
+		} else {
+			at := uint64(t.order.Uint32(raw[8:]))
+			if at+total > uint64(len(t.data)) {
+				continue // Skip a broken tag rather than the whole image
+			}
+			value = t.data[at : at+total]
+		}
+		entries[tag] = ifdEntry{typ: typ, count: n, value: value}
+	}
+	return entries, nil
+}
+
+func (t *tiffReader) uint32(e ifdEntry) (uint32, bool) {
+	switch {
+	case e.typ == 4 && e.count >= 1:
+		return t.order.Uint32(e.value), true
+	case e.typ == 3 && e.count >= 1:
+		return uint32(t.order.Uint16(e.value)), true
+	default:
+		return 0, false
+	}
+}
+
+func (t *tiffReader) ascii(e ifdEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+// rationals reads n unsigned rationals, failing on a zero denominator.
+func (t *tiffReader) rationals(e ifdEntry, n int) ([]float64, bool) {
+	if e.typ != 5 || int(e.count) < n {
+		return nil, false
+	}
+
+	values := make([]float64, n)
+	for i := range values {
+		num := t.order.Uint32(e.value[i*8:])
+		den := t.order.Uint32(e.value[i*8+4:])
+		if den == 0 {
+			return nil, false
+		}
+		values[i] = float64(num) / float64(den)
+	}
+	return values, true
+}
+
+func (t *tiffReader) location(gps map[uint16]ifdEntry) *orb.Point {
+	lat, ok := t.rationals(gps[tagGPSLatitude], 3)
+	if !ok {
+		return nil
+	}
+	lng, ok := t.rationals(gps[tagGPSLongitude], 3)
+	if !ok {
+		return nil
+	}
+
+	latDeg := lat[0] + lat[1]/60 + lat[2]/3600
+	lngDeg := lng[0] + lng[1]/60 + lng[2]/3600
+	if t.ascii(gps[tagGPSLatitudeRef]) == "S" {
+		latDeg = -latDeg
+	}
+	if t.ascii(gps[tagGPSLongitudeRef]) == "W" {
+		lngDeg = -lngDeg
+	}
+
+	// Cameras without a fix sometimes write zeros instead of leaving it out
+	if latDeg > 90 || latDeg < -90 || lngDeg > 180 || lngDeg < -180 || (latDeg == 0 && lngDeg == 0) {
+		return nil
+	}
+	return &orb.Point{lngDeg, latDeg}
+}
+
+// parseTime reads an EXIF date-time, with its "+09:00" style offset if known.
+func parseTime(raw, zone string) (time.Time, bool) {
+	if raw == "" {
+		return time.Time{}, false
+	}
+
+	if zone != "" {
+		ts, err := time.Parse(exifTimeLayout+"-07:00", raw+zone)
+		return ts, err == nil
+	}
+	ts, err := time.Parse(exifTimeLayout, raw)
+	return ts, err == nil
+}
+
+func (t *tiffReader) gpsTime(gps map[uint16]ifdEntry) (time.Time, bool) {
+	date, err := time.Parse("2006:01:02", t.ascii(gps[tagGPSDateStamp]))
+	if err != nil {
+		return time.Time{}, false
+	}
+	hms, ok := t.rationals(gps[tagGPSTimeStamp], 3)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	clock := time.Duration(hms[0]*float64(time.Hour)) +
+		time.Duration(hms[1]*float64(time.Minute)) +
+		time.Duration(hms[2]*float64(time.Second))
+	return date.Add(clock), true
+}
@@ -0,0 +1,369 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// entry is an IFD entry to lay out with buildTIFF.
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+func asciiEntry(tag uint16, s string) entry {
+	return entry{tag: tag, typ: 2, count: uint32(len(s) + 1), data: []byte(s + "\x00")}
+}
+
+func shortEntry(order binary.ByteOrder, tag uint16, v uint16) entry {
+	data := make([]byte, 2)
+	order.PutUint16(data, v)
+	return entry{tag: tag, typ: 3, count: 1, data: data}
+}
+
+func rationalEntry(order binary.ByteOrder, tag uint16, values ...[2]uint32) entry {
+	data := make([]byte, 8*len(values))
+	for i, v := range values {
+		order.PutUint32(data[i*8:], v[0])
+		order.PutUint32(data[i*8+4:], v[1])
+	}
+	return entry{tag: tag, typ: 5, count: uint32(len(values)), data: data}
+}
+
+func degrees(d, m, s uint32) [][2]uint32 {
+	return [][2]uint32{{d, 1}, {m, 1}, {s * 100, 100}}
+}
+
+// buildTIFF lays out IFD0 followed by the Exif and GPS IFDs, when given,
+// and a data area for values longer than four bytes.
+func buildTIFF(order binary.ByteOrder, ifd0, exifIFD, gpsIFD []entry) []byte {
+	ifdSize := func(entries []entry) uint32 { return uint32(2 + 12*len(entries) + 4) }
+
+	if exifIFD != nil {
+		ifd0 = append(ifd0, entry{tag: tagExifIFD, typ: 4, count: 1, data: make([]byte, 4)})
+	}
+	if gpsIFD != nil {
+		ifd0 = append(ifd0, entry{tag: tagGPSIFD, typ: 4, count: 1, data: make([]byte, 4)})
+	}
+
+	exifAt := 8 + ifdSize(ifd0)
+	gpsAt := exifAt
+	if exifIFD != nil {
+		gpsAt += ifdSize(exifIFD)
+	}
+	dataAt := gpsAt
+	if gpsIFD != nil {
+		dataAt += ifdSize(gpsIFD)
+	}
+	for i := range ifd0 {
+		switch ifd0[i].tag {
+		case tagExifIFD:
+			order.PutUint32(ifd0[i].data, exifAt)
+		case tagGPSIFD:
+			order.PutUint32(ifd0[i].data, gpsAt)
+		}
+	}
+
+	var head, data bytes.Buffer
+	if order == binary.LittleEndian {
+		head.WriteString("II")
+	} else {
+		head.WriteString("MM")
+	}
+	binary.Write(&head, order, uint16(42))
+	binary.Write(&head, order, uint32(8))
+
+	for _, ifd := range [][]entry{ifd0, exifIFD, gpsIFD} {
+		if ifd == nil {
+			continue
+		}
+		binary.Write(&head, order, uint16(len(ifd)))
+		for _, e := range ifd {
+			binary.Write(&head, order, e.tag)
+			binary.Write(&head, order, e.typ)
+			binary.Write(&head, order, e.count)
+			if len(e.data) <= 4 {
+				value := make([]byte, 4)
+				copy(value, e.data)
+				head.Write(value)
+				continue
+			}
+			binary.Write(&head, order, dataAt+uint32(data.Len()))
+			data.Write(e.data)
+		}
+		binary.Write(&head, order, uint32(0))
+	}
+	return append(head.Bytes(), data.Bytes()...)
+}
+
+func jpegWithExif(tiff []byte) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0xFF, 0xD8})
+	// An XMP APP1 segment first, which must be skipped
+	xmp := []byte("http://ns.adobe.com/xap/1.0/\x00<x/>")
+	b.Write([]byte{0xFF, 0xE1})
+	binary.Write(&b, binary.BigEndian, uint16(len(xmp)+2))
+	b.Write(xmp)
+	if tiff != nil {
+		b.Write([]byte{0xFF, 0xE1})
+		binary.Write(&b, binary.BigEndian, uint16(len(tiff)+8))
+		b.WriteString("Exif\x00\x00")
+		b.Write(tiff)
+	}
+	b.Write([]byte{0xFF, 0xDA, 0x00, 0x02})
+	return b.Bytes()
+}
+
+func pngWithExif(tiff []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x89PNG\r\n\x1a\n")
+	chunk := func(typ string, data []byte) {
+		binary.Write(&b, binary.BigEndian, uint32(len(data)))
+		b.WriteString(typ)
+		b.Write(data)
+		b.Write([]byte{0, 0, 0, 0}) // CRC, not checked
+	}
+	chunk("IHDR", make([]byte, 13))
+	if tiff != nil {
+		chunk("eXIf", tiff)
+	}
+	chunk("IEND", nil)
+	return b.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	tokyo := time.FixedZone("", 9*3600)
+
+	tests := []struct {
+		name        string
+		image       []byte
+		wantLat     float64
+		wantLng     float64
+		noLocation  bool
+		wantTime    time.Time
+		wantZone    bool
+		orientation int
+	}{
+		{
+			name: "jpeg with gps and offset time",
+			image: jpegWithExif(buildTIFF(le,
+				[]entry{shortEntry(le, tagOrientation, 6)},
+				[]entry{
+					asciiEntry(tagDateTimeOriginal, "2024:05:01 10:30:00"),
+					asciiEntry(tagOffsetTimeOriginal, "+09:00"),
+				},
+				[]entry{
+					asciiEntry(tagGPSLatitudeRef, "N"),
+					rationalEntry(le, tagGPSLatitude, degrees(35, 39, 29)...),
+					asciiEntry(tagGPSLongitudeRef, "E"),
+					rationalEntry(le, tagGPSLongitude, degrees(139, 42, 1)...),
+				},
+			)),
+			wantLat:     35 + 39.0/60 + 29.0/3600,
+			wantLng:     139 + 42.0/60 + 1.0/3600,
+			wantTime:    time.Date(2024, 5, 1, 10, 30, 0, 0, tokyo),
+			wantZone:    true,
+			orientation: 6,
+		},
+		{
+			name: "big endian, southern and western hemispheres",
+			image: jpegWithExif(buildTIFF(be, nil, nil, []entry{
+				asciiEntry(tagGPSLatitudeRef, "S"),
+				rationalEntry(be, tagGPSLatitude, degrees(33, 52, 4)...),
+				asciiEntry(tagGPSLongitudeRef, "W"),
+				rationalEntry(be, tagGPSLongitude, degrees(70, 40, 0)...),
+			})),
+			wantLat:     -(33 + 52.0/60 + 4.0/3600),
+			wantLng:     -(70 + 40.0/60),
+			orientation: 1,
+		},
+		{
+			name: "png exif chunk, gps clock without camera offset",
+			image: pngWithExif(buildTIFF(le, nil,
+				[]entry{asciiEntry(tagDateTimeOriginal, "2024:05:01 10:30:00")},
+				[]entry{
+					rationalEntry(le, tagGPSLatitude, degrees(48, 51, 24)...),
+					rationalEntry(le, tagGPSLongitude, degrees(2, 21, 8)...),
+					asciiEntry(tagGPSDateStamp, "2024:05:01"),
+					rationalEntry(le, tagGPSTimeStamp, [2]uint32{8, 1}, [2]uint32{30, 1}, [2]uint32{15, 1}),
+				},
+			)),
+			wantLat:     48 + 51.0/60 + 24.0/3600,
+			wantLng:     2 + 21.0/60 + 8.0/3600,
+			wantTime:    time.Date(2024, 5, 1, 8, 30, 15, 0, time.UTC),
+			wantZone:    true,
+			orientation: 1,
+		},
+		{
+			name: "camera clock only",
+			image: jpegWithExif(buildTIFF(le, nil,
+				[]entry{asciiEntry(tagDateTimeOriginal, "2024:05:01 10:30:00")}, nil,
+			)),
+			noLocation:  true,
+			wantTime:    time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC),
+			orientation: 1,
+		},
+		{
+			name: "zero fix is no fix",
+			image: jpegWithExif(buildTIFF(le, nil, nil, []entry{
+				rationalEntry(le, tagGPSLatitude, degrees(0, 0, 0)...),
+				rationalEntry(le, tagGPSLongitude, degrees(0, 0, 0)...),
+			})),
+			noLocation:  true,
+			orientation: 1,
+		},
+		{
+			name: "zero denominator",
+			image: jpegWithExif(buildTIFF(le, nil, nil, []entry{
+				rationalEntry(le, tagGPSLatitude, [2]uint32{10, 0}, [2]uint32{0, 1}, [2]uint32{0, 1}),
+				rationalEntry(le, tagGPSLongitude, degrees(10, 0, 0)...),
+			})),
+			noLocation:  true,
+			orientation: 1,
+		},
+		{
+			name: "latitude out of range",
+			image: jpegWithExif(buildTIFF(le, nil, nil, []entry{
+				rationalEntry(le, tagGPSLatitude, degrees(95, 0, 0)...),
+				rationalEntry(le, tagGPSLongitude, degrees(10, 0, 0)...),
+			})),
+			noLocation:  true,
+			orientation: 1,
+		},
+		{
+			name: "invalid orientation is ignored",
+			image: jpegWithExif(buildTIFF(le,
+				[]entry{shortEntry(le, tagOrientation, 42)}, nil, nil,
+			)),
+			noLocation:  true,
+			orientation: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Decode(bytes.NewReader(tt.image))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+
+			if tt.noLocation {
+				if info.Location != nil {
+					t.Errorf("Location = %v, want none", *info.Location)
+				}
+			} else {
+				if info.Location == nil {
+					t.Fatal("Location = nil")
+				}
+				if math.Abs(info.Location.Lat()-tt.wantLat) > 1e-9 || math.Abs(info.Location.Lon()-tt.wantLng) > 1e-9 {
+					t.Errorf("Location = %v, want [%v %v]", *info.Location, tt.wantLng, tt.wantLat)
+				}
+			}
+
+			if !info.Time.Equal(tt.wantTime) {
+				t.Errorf("Time = %v, want %v", info.Time, tt.wantTime)
+			}
+			if info.HasZone != tt.wantZone {
+				t.Errorf("HasZone = %v, want %v", info.HasZone, tt.wantZone)
+			}
+			if info.Orientation != tt.orientation {
+				t.Errorf("Orientation = %d, want %d", info.Orientation, tt.orientation)
+			}
+		})
+	}
+}
+
+func TestDecodeBrokenTagIsSkipped(t *testing.T) {
+	le := binary.LittleEndian
+	tiff := buildTIFF(le, nil,
+		[]entry{asciiEntry(tagDateTimeOriginal, "2024:05:01 10:30:00")},
+		[]entry{
+			rationalEntry(le, tagGPSLatitude, degrees(10, 0, 0)...),
+			rationalEntry(le, tagGPSLongitude, degrees(10, 0, 0)...),
+		},
+	)
+	// Point the latitude's value past the end of the block
+	gpsAt := le.Uint32(tiff[8+2+12+8:])
+	le.PutUint32(tiff[gpsAt+2+8:], uint32(len(tiff)))
+
+	info, err := Decode(bytes.NewReader(jpegWithExif(tiff)))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if info.Location != nil {
+		t.Errorf("Location = %v, want none", *info.Location)
+	}
+	if info.Time.IsZero() {
+		t.Error("Time was lost along with the broken tag")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	le := binary.LittleEndian
+	valid := buildTIFF(le, []entry{shortEntry(le, tagOrientation, 1)}, nil, nil)
+
+	withIFDOffset := func(offset uint32) []byte {
+		tiff := bytes.Clone(valid)
+		le.PutUint32(tiff[4:], offset)
+		return tiff
+	}
+	withIFDCount := func(count uint16) []byte {
+		tiff := bytes.Clone(valid)
+		le.PutUint16(tiff[8:], count)
+		return tiff
+	}
+	withExifIFDOffset := func(offset uint32) []byte {
+		tiff := buildTIFF(le, nil, []entry{}, nil)
+		le.PutUint32(tiff[8+2+8:], offset)
+		return tiff
+	}
+
+	truncatedSegment := jpegWithExif(valid)
+	truncatedSegment = truncatedSegment[:len(truncatedSegment)-len(valid)/2-4]
+
+	oversizedChunk := []byte("\x89PNG\r\n\x1a\n\x7f\xff\xff\xffeXIf")
+
+	tests := []struct {
+		name    string
+		image   []byte
+		wantErr error
+	}{
+		{"not an image", []byte("GIF89a......"), nil},
+		{"too short to sniff", []byte{0xFF, 0xD8}, nil},
+		{"jpeg without exif", jpegWithExif(nil), ErrNoExif},
+		{"png without exif", pngWithExif(nil), ErrNoExif},
+		{"truncated jpeg segment", truncatedSegment, nil},
+		{"jpeg segment shorter than its length", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x01, 0, 0}, nil},
+		{"garbage instead of a marker", []byte{0xFF, 0xD8, 0x00, 0x00, 0, 0, 0, 0}, nil},
+		{"png exif chunk too large", oversizedChunk, nil},
+		{"tiff block too short", jpegWithExif([]byte("II*\x00")), nil},
+		{"bad byte order", jpegWithExif(append([]byte("XX"), valid[2:]...)), nil},
+		{"bad magic number", jpegWithExif(append([]byte("II\x2b\x00"), valid[4:]...)), nil},
+		{"ifd0 out of bounds", jpegWithExif(withIFDOffset(1 << 20)), nil},
+		{"ifd0 offset overflows", jpegWithExif(withIFDOffset(math.MaxUint32)), nil},
+		{"ifd0 entry count past the end", jpegWithExif(withIFDCount(0xFFFF)), nil},
+		{"exif ifd out of bounds", jpegWithExif(withExifIFDOffset(1 << 20)), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Decode(bytes.NewReader(tt.image))
+			if err == nil {
+				t.Fatalf("Decode = %+v, want an error", info)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decode error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && errors.Is(err, ErrNoExif) {
+				t.Errorf("Decode error = %v, want a malformed-data error", err)
+			}
+		})
+	}
+}
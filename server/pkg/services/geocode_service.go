@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"log"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/geocoder"
+)
+
+// resolvePlace fills in cp.Place from its location. A failed lookup is not
+// fatal: the checkpoint keeps an empty place and the generic title.
+func (s *JourneyService) resolvePlace(cp *models.Checkpoint) {
+	place, err := s.Geocoder.Reverse(cp.Location.Point.Lat(), cp.Location.Point.Lon())
+	if err != nil {
+		if !errors.Is(err, geocoder.ErrNoPlace) {
+			log.Printf("Reverse geocoding checkpoint %d failed: %v", cp.ID, err)
+		}
+		cp.Place = models.Place{}
+		return
+	}
+
+	cp.Place = models.Place{
+		Locality:    place.Locality,
+		Region:      place.Region,
+		Country:     place.Country,
+		CountryCode: place.CountryCode,
+	}
+}
+
+// Checkpoints waiting to be geocoded. When the queue is full, new ones keep
+// the generic title rather than hold up the request.
+const placeQueueSize = 10_000
+
+// resolvePlacesAsync queues stored checkpoints for reverse geocoding, so no
+// request waits on the provider. A single worker drains the queue, which
+// keeps a remote provider to one caller.
+func (s *JourneyService) resolvePlacesAsync(checkpoints []models.Checkpoint) {
+	for _, cp := range checkpoints {
+		select {
+		case s.places <- cp:
+		default:
+			log.Printf("Geocoding queue is full, checkpoint %d keeps no place", cp.ID)
+		}
+	}
+}
+
+// resolvePlaces is the geocoding worker, started with the service.
+func (s *JourneyService) resolvePlaces() {
+	for cp := range s.places {
+		s.resolvePlace(&cp)
+		if cp.Place == (models.Place{}) {
+			continue
+		}
+
+		// A checkpoint moved since it was queued is queued again; skip the old spot
+		point := cp.Location.Point
+		err := s.DB.Model(&models.Checkpoint{}).
+			Where("id = ? AND ST_Equals(location, ST_SetSRID(ST_MakePoint(?, ?), 4326))", cp.ID, point.Lon(), point.Lat()).
+			Updates(placeColumns(cp.Place)).Error
+		if err != nil {
+			log.Printf("Saving place of checkpoint %d failed: %v", cp.ID, err)
+		}
+	}
+}
+
+func placeColumns(p models.Place) map[string]interface{} {
+	return map[string]interface{}{
+		"place_locality":     p.Locality,
+		"place_region":       p.Region,
+		"place_country":      p.Country,
+		"place_country_code": p.CountryCode,
+	}
+}
@@ -0,0 +1,50 @@
+package geocoder
+
+import (
+	"errors"
+	"log"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/config"
+)
+
+// ErrNoPlace is returned when a location does not resolve to any place.
+var ErrNoPlace = errors.New("no place found")
+
+type Place struct {
+	Locality    string
+	Region      string
+	Country     string
+	CountryCode string // ISO 3166-1 alpha-2, upper case
+}
+
+type Geocoder interface {
+	// Reverse resolves a location to the place it lies in or near.
+	Reverse(lat, lng float64) (*Place, error)
+}
+
+func NewGeocoder() Geocoder {
+	cfg := config.AppConfig
+
+	switch cfg.GEOCODER_DRIVER {
+	case "none":
+		return NoopGeocoder{}
+	case "http":
+		return NewHTTPGeocoder(cfg.GEOCODER_URL, cfg.GEOCODER_USER_AGENT)
+	case "offline":
+		fallthrough
+	default:
+		g, err := NewOfflineGeocoder(cfg.GEOCODER_GAZETTEER_PATH)
+		if err != nil {
+			log.Printf("Failed to load gazetteer, reverse geocoding disabled: %v", err)
+			return NoopGeocoder{}
+		}
+		return g
+	}
+}
+
+// NoopGeocoder resolves nothing; checkpoints keep their generic title.
+type NoopGeocoder struct{}
+
+func (NoopGeocoder) Reverse(lat, lng float64) (*Place, error) {
+	return nil, ErrNoPlace
+}
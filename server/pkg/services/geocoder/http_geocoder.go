@@ -0,0 +1,188 @@
+package geocoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lookups are cached on a ~100m grid; a long track hits the provider once per
+// cell rather than once per point.
+const (
+	cacheGrid     = 1000.0
+	maxCacheItems = 10_000
+)
+
+// Nominatim's usage policy allows at most one request per second.
+const minRequestInterval = time.Second
+
+// HTTPGeocoder queries a Nominatim-compatible /reverse endpoint.
+type HTTPGeocoder struct {
+	baseURL   string
+	userAgent string
+	client    *http.Client
+
+	mu    sync.Mutex
+	cache map[[2]int64]*Place
+
+	// Shared by every caller, so the provider sees one request per interval
+	rateMu   sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// HTTPOption adjusts an HTTPGeocoder, e.g. to point it at a test server.
+type HTTPOption func(*HTTPGeocoder)
+
+// WithRequestInterval sets the minimum time between two requests to the
+// provider. Public Nominatim needs the default of a second.
+func WithRequestInterval(interval time.Duration) HTTPOption {
+	return func(g *HTTPGeocoder) {
+		g.interval = interval
+	}
+}
+
+// WithHTTPClient replaces the client requests are sent with.
+func WithHTTPClient(client *http.Client) HTTPOption {
+	return func(g *HTTPGeocoder) {
+		g.client = client
+	}
+}
+
+func NewHTTPGeocoder(baseURL, userAgent string, opts ...HTTPOption) *HTTPGeocoder {
+	if userAgent == "" {
+		userAgent = "TrailStory"
+	}
+	g := &HTTPGeocoder{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		cache:     map[[2]int64]*Place{},
+		interval:  minRequestInterval,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+type nominatimResponse struct {
+	Error   string `json:"error"`
+	Address struct {
+		City        string `json:"city"`
+		Town        string `json:"town"`
+		Village     string `json:"village"`
+		Hamlet      string `json:"hamlet"`
+		County      string `json:"county"`
+		State       string `json:"state"`
+		Country     string `json:"country"`
+		CountryCode string `json:"country_code"`
+	} `json:"address"`
+}
+
+func (g *HTTPGeocoder) Reverse(lat, lng float64) (*Place, error) {
+	key := [2]int64{int64(math.Round(lat * cacheGrid)), int64(math.Round(lng * cacheGrid))}
+
+	g.mu.Lock()
+	cached, ok := g.cache[key]
+	g.mu.Unlock()
+	if ok {
+		if cached == nil {
+			return nil, ErrNoPlace
+		}
+		place := *cached
+		return &place, nil
+	}
+
+	place, err := g.fetch(lat, lng)
+	if err != nil && err != ErrNoPlace {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	if len(g.cache) >= maxCacheItems {
+		g.cache = map[[2]int64]*Place{}
+	}
+	g.cache[key] = place
+	g.mu.Unlock()
+
+	if place == nil {
+		return nil, ErrNoPlace
+	}
+	copied := *place
+	return &copied, nil
+}
+
+// wait blocks until the rate limit allows another request.
+func (g *HTTPGeocoder) wait() {
+	g.rateMu.Lock()
+	defer g.rateMu.Unlock()
+
+	if d := time.Until(g.next); d > 0 {
+		time.Sleep(d)
+	}
+	g.next = time.Now().Add(g.interval)
+}
+
+func (g *HTTPGeocoder) fetch(lat, lng float64) (*Place, error) {
+	g.wait()
+
+	query := url.Values{}
+	query.Set("format", "jsonv2")
+	query.Set("lat", strconv.FormatFloat(lat, 'f', -1, 64))
+	query.Set("lon", strconv.FormatFloat(lng, 'f', -1, 64))
+	query.Set("zoom", "10")
+
+	req, err := http.NewRequest(http.MethodGet, g.baseURL+"/reverse?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", g.userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geocoder returned %s", resp.Status)
+	}
+
+	var body nominatimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding geocoder response: %w", err)
+	}
+	if body.Error != "" {
+		// Nominatim answers 200 with an error for open sea and the like
+		return nil, ErrNoPlace
+	}
+
+	addr := body.Address
+	place := &Place{
+		Locality:    firstNonEmpty(addr.City, addr.Town, addr.Village, addr.Hamlet),
+		Region:      firstNonEmpty(addr.State, addr.County),
+		Country:     addr.Country,
+		CountryCode: strings.ToUpper(addr.CountryCode),
+	}
+	if *place == (Place{}) {
+		return nil, ErrNoPlace
+	}
+	return place, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package geocoder
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestGeocoder(t *testing.T, handler http.HandlerFunc, opts ...HTTPOption) *HTTPGeocoder {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	opts = append([]HTTPOption{WithRequestInterval(0), WithHTTPClient(server.Client())}, opts...)
+	return NewHTTPGeocoder(server.URL+"/", "TrailStory-test", opts...)
+}
+
+func TestHTTPGeocoderReverse(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    *Place
+		wantErr error
+	}{
+		{
+			name:   "city",
+			status: http.StatusOK,
+			body:   `{"address":{"city":"Lyon","state":"Auvergne-Rhône-Alpes","country":"France","country_code":"fr"}}`,
+			want:   &Place{Locality: "Lyon", Region: "Auvergne-Rhône-Alpes", Country: "France", CountryCode: "FR"},
+		},
+		{
+			name:   "village and county",
+			status: http.StatusOK,
+			body:   `{"address":{"village":"Grindelwald","county":"Interlaken","country":"Switzerland","country_code":"ch"}}`,
+			want:   &Place{Locality: "Grindelwald", Region: "Interlaken", Country: "Switzerland", CountryCode: "CH"},
+		},
+		{
+			name:    "open sea",
+			status:  http.StatusOK,
+			body:    `{"error":"Unable to geocode"}`,
+			wantErr: ErrNoPlace,
+		},
+		{
+			name:    "empty address",
+			status:  http.StatusOK,
+			body:    `{"address":{}}`,
+			wantErr: ErrNoPlace,
+		},
+		{
+			name:   "server error",
+			status: http.StatusServiceUnavailable,
+			body:   `oops`,
+		},
+		{
+			name:   "malformed body",
+			status: http.StatusOK,
+			body:   `{"address":`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGeocoder(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/reverse" || r.URL.Query().Get("lat") != "45.76" || r.URL.Query().Get("lon") != "4.84" {
+					t.Errorf("unexpected request %s", r.URL)
+				}
+				if r.Header.Get("User-Agent") != "TrailStory-test" {
+					t.Errorf("User-Agent = %q", r.Header.Get("User-Agent"))
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			place, err := g.Reverse(45.76, 4.84)
+			switch {
+			case tt.want != nil:
+				if err != nil {
+					t.Fatalf("Reverse: %v", err)
+				}
+				if *place != *tt.want {
+					t.Errorf("Reverse = %+v, want %+v", *place, *tt.want)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Reverse error = %v, want %v", err, tt.wantErr)
+				}
+			default:
+				if err == nil || errors.Is(err, ErrNoPlace) {
+					t.Errorf("Reverse error = %v, want a provider error", err)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPGeocoderCachesByGridCell(t *testing.T) {
+	var requests atomic.Int32
+	g := newTestGeocoder(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"address":{"town":"Chamonix","country":"France","country_code":"fr"}}`))
+	})
+
+	for _, lat := range []float64{45.9237, 45.92372, 45.92368} {
+		if _, err := g.Reverse(lat, 6.8694); err != nil {
+			t.Fatalf("Reverse(%v): %v", lat, err)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("requests within one cell = %d, want 1", got)
+	}
+
+	if _, err := g.Reverse(45.95, 6.8694); err != nil {
+		t.Fatalf("Reverse: %v", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests after leaving the cell = %d, want 2", got)
+	}
+}
+
+func TestHTTPGeocoderRateLimit(t *testing.T) {
+	const interval = 20 * time.Millisecond
+
+	var times []time.Time
+	g := newTestGeocoder(t, func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		w.Write([]byte(`{"error":"Unable to geocode"}`))
+	}, WithRequestInterval(interval))
+
+	for i := range 3 {
+		g.Reverse(float64(i), 0)
+	}
+
+	if len(times) != 3 {
+		t.Fatalf("requests = %d, want 3", len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < interval {
+			t.Errorf("request %d came %v after the previous one, want at least %v", i, gap, interval)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package geocoder
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+)
+
+// A small world gazetteer used when GEOCODER_GAZETTEER_PATH is not set.
+//
+//go:embed gazetteer.csv
+var bundledGazetteer string
+
+// Beyond localityRadius the nearest entry only names the region and country;
+// beyond regionRadius the location is treated as unknown.
+const (
+	localityRadius = 25_000.0
+	regionRadius   = 250_000.0
+)
+
+const metersPerDegree = 111_320.0
+
+type gazetteerEntry struct {
+	Place
+	Location orb.Point
+	TimeZone string
+}
+
+// OfflineGeocoder answers from a gazetteer held in memory: the nearest entry
+// wins. Entries are sorted by latitude so a lookup only scans a band.
+type OfflineGeocoder struct {
+	entries []gazetteerEntry
+}
+
+// NewOfflineGeocoder loads the gazetteer at path, or the bundled one when path
+// is empty. The file is CSV with the header
+// name,region,country,country_code,lat,lng,timezone.
+func NewOfflineGeocoder(path string) (*OfflineGeocoder, error) {
+	if path == "" {
+		return parseGazetteer(strings.NewReader(bundledGazetteer))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseGazetteer(f)
+}
+
+func parseGazetteer(r io.Reader) (*OfflineGeocoder, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 7
+
+	if _, err := reader.Read(); err != nil {
+		return nil, fmt.Errorf("reading gazetteer header: %w", err)
+	}
+
+	var entries []gazetteerEntry
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lat, err := strconv.ParseFloat(rec[4], 64)
+		if err != nil || lat < -90 || lat > 90 {
+			return nil, fmt.Errorf("gazetteer entry %q: invalid latitude %q", rec[0], rec[4])
+		}
+		lng, err := strconv.ParseFloat(rec[5], 64)
+		if err != nil || lng < -180 || lng > 180 {
+			return nil, fmt.Errorf("gazetteer entry %q: invalid longitude %q", rec[0], rec[5])
+		}
+
+		entries = append(entries, gazetteerEntry{
+			Place: Place{
+				Locality:    rec[0],
+				Region:      rec[1],
+				Country:     rec[2],
+				CountryCode: strings.ToUpper(rec[3]),
+			},
+			Location: orb.Point{lng, lat},
+			TimeZone: rec[6],
+		})
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("gazetteer is empty")
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Location.Lat() < entries[j].Location.Lat()
+	})
+	return &OfflineGeocoder{entries: entries}, nil
+}
+
+func (g *OfflineGeocoder) Reverse(lat, lng float64) (*Place, error) {
+	entry, dist := g.nearest(orb.Point{lng, lat}, regionRadius)
+	if entry == nil {
+		return nil, ErrNoPlace
+	}
+
+	place := entry.Place
+	if dist > localityRadius {
+		place.Locality = ""
+	}
+	return &place, nil
+}
+
+// nearest returns the closest entry within maxDist meters, or nil.
+func (g *OfflineGeocoder) nearest(p orb.Point, maxDist float64) (*gazetteerEntry, float64) {
+	band := maxDist / metersPerDegree
+	start := sort.Search(len(g.entries), func(i int) bool {
+		return g.entries[i].Location.Lat() >= p.Lat()-band
+	})
+
+	var best *gazetteerEntry
+	bestDist := maxDist
+	for i := start; i < len(g.entries) && g.entries[i].Location.Lat() <= p.Lat()+band; i++ {
+		if d := geo.Distance(p, g.entries[i].Location); d <= bestDist {
+			best, bestDist = &g.entries[i], d
+		}
+	}
+	return best, bestDist
+}
@@ -0,0 +1,73 @@
+package geocoder
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	// Embedded so zones resolve on images without a system tz database
+	_ "time/tzdata"
+
+	"github.com/paulmach/orb"
+)
+
+// Points further than this from any gazetteer entry (open ocean, the poles)
+// get the nautical zone of their longitude instead.
+const timeZoneRadius = 1_000_000.0
+
+var (
+	zonesOnce sync.Once
+	zones     *OfflineGeocoder
+
+	locationsMu sync.Mutex
+	locations   = map[string]*time.Location{}
+)
+
+// TimeZoneAt returns the IANA time zone name at a location, derived offline
+// from the nearest entry of the bundled gazetteer.
+func TimeZoneAt(lat, lng float64) string {
+	zonesOnce.Do(func() {
+		zones, _ = parseGazetteer(strings.NewReader(bundledGazetteer))
+	})
+
+	if zones != nil {
+		if entry, _ := zones.nearest(orb.Point{lng, lat}, timeZoneRadius); entry != nil && entry.TimeZone != "" {
+			return entry.TimeZone
+		}
+	}
+	return nauticalZone(lng)
+}
+
+// LocationAt is TimeZoneAt loaded as a *time.Location, UTC if it is unknown.
+func LocationAt(lat, lng float64) *time.Location {
+	name := TimeZoneAt(lat, lng)
+
+	locationsMu.Lock()
+	defer locationsMu.Unlock()
+
+	if loc, ok := locations[name]; ok {
+		return loc
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc = time.UTC
+	}
+	locations[name] = loc
+	return loc
+}
+
+// nauticalZone maps a longitude to its whole-hour Etc/GMT zone. The Etc names
+// use POSIX signs: Etc/GMT-9 is nine hours ahead of UTC.
+func nauticalZone(lng float64) string {
+	offset := int(math.Round(lng / 15))
+	switch {
+	case offset > 0:
+		return fmt.Sprintf("Etc/GMT-%d", offset)
+	case offset < 0:
+		return fmt.Sprintf("Etc/GMT+%d", -offset)
+	default:
+		return "Etc/GMT"
+	}
+}
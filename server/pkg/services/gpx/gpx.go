@@ -0,0 +1,230 @@
+package gpx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+)
+
+/*
+
+Supported subset of GPX 1.1 ->
+
+<gpx version="1.1" creator="...">
+  <metadata><name/><desc/><time/></metadata>
+  <wpt lat="" lon=""><time/><name/><desc/></wpt>
+  <trk><name/><desc/>
+    <trkseg><trkpt lat="" lon=""><time/></trkpt></trkseg>
+  </trk>
+</gpx>
+
+*/
+
+const Namespace = "http://www.topografix.com/GPX/1/1"
+
+type Document struct {
+	XMLName   xml.Name  `xml:"gpx"`
+	Version   string    `xml:"version,attr"`
+	Creator   string    `xml:"creator,attr"`
+	Metadata  *Metadata `xml:"metadata,omitempty"`
+	Waypoints []Point   `xml:"wpt"`
+	Tracks    []Track   `xml:"trk"`
+}
+
+type Metadata struct {
+	Name string `xml:"name,omitempty"`
+	Desc string `xml:"desc,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+type Track struct {
+	Name     string    `xml:"name,omitempty"`
+	Desc     string    `xml:"desc,omitempty"`
+	Segments []Segment `xml:"trkseg"`
+}
+
+type Segment struct {
+	Points []Point `xml:"trkpt"`
+}
+
+type Point struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele,omitempty"`
+	Time string   `xml:"time,omitempty"`
+	Name string   `xml:"name,omitempty"`
+	Cmt  string   `xml:"cmt,omitempty"`
+	Desc string   `xml:"desc,omitempty"`
+}
+
+// Parse decodes and validates a GPX 1.1 document. The returned errors are
+// meant to be shown to the uploader as-is.
+func Parse(r io.Reader) (*Document, error) {
+	var doc Document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("file is empty")
+		}
+		var syntaxErr *xml.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, fmt.Errorf("malformed XML on line %d: %s", syntaxErr.Line, syntaxErr.Msg)
+		}
+		if strings.Contains(err.Error(), "expected element type <gpx>") {
+			return nil, errors.New("root element must be <gpx>")
+		}
+		return nil, fmt.Errorf("could not read GPX: %v", err)
+	}
+
+	if doc.Version != "1.1" {
+		return nil, fmt.Errorf("unsupported GPX version %q, expected 1.1", doc.Version)
+	}
+
+	if doc.Metadata != nil && doc.Metadata.Time != "" {
+		if _, err := parseTime(doc.Metadata.Time); err != nil {
+			return nil, fmt.Errorf("metadata: %v", err)
+		}
+	}
+
+	for i, p := range doc.Waypoints {
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("waypoint %d: %v", i+1, err)
+		}
+	}
+
+	for t, trk := range doc.Tracks {
+		for s, seg := range trk.Segments {
+			for i, p := range seg.Points {
+				if err := p.validate(); err != nil {
+					return nil, fmt.Errorf("track %d, segment %d, point %d: %v", t+1, s+1, i+1, err)
+				}
+			}
+		}
+	}
+
+	if len(doc.Waypoints) == 0 && len(doc.TrackPoints()) == 0 {
+		return nil, errors.New("file contains no waypoints or track points")
+	}
+
+	return &doc, nil
+}
+
+// Encode writes the document with the GPX 1.1 namespace and an XML header.
+func Encode(w io.Writer, doc *Document) error {
+	doc.Version = "1.1"
+	if doc.Creator == "" {
+		doc.Creator = "TrailStory"
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	start := xml.StartElement{
+		Name: xml.Name{Local: "gpx"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: Namespace}},
+	}
+	if err := enc.EncodeElement(doc, start); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// Name returns the best available title for the document.
+func (d *Document) Name() string {
+	if d.Metadata != nil && d.Metadata.Name != "" {
+		return d.Metadata.Name
+	}
+	for _, trk := range d.Tracks {
+		if trk.Name != "" {
+			return trk.Name
+		}
+	}
+	return ""
+}
+
+// Description returns the best available description for the document.
+func (d *Document) Description() string {
+	if d.Metadata != nil && d.Metadata.Desc != "" {
+		return d.Metadata.Desc
+	}
+	for _, trk := range d.Tracks {
+		if trk.Desc != "" {
+			return trk.Desc
+		}
+	}
+	return ""
+}
+
+// StartTime returns the metadata time, if any.
+func (d *Document) StartTime() (time.Time, bool) {
+	if d.Metadata == nil || d.Metadata.Time == "" {
+		return time.Time{}, false
+	}
+	t, err := parseTime(d.Metadata.Time)
+	return t, err == nil
+}
+
+// TrackPoints flattens every segment of every track, in file order.
+func (d *Document) TrackPoints() []Point {
+	var points []Point
+	for _, trk := range d.Tracks {
+		for _, seg := range trk.Segments {
+			points = append(points, seg.Points...)
+		}
+	}
+	return points
+}
+
+// Timestamp returns the parsed <time> of the point, if present.
+func (p Point) Timestamp() (time.Time, bool) {
+	if p.Time == "" {
+		return time.Time{}, false
+	}
+	t, err := parseTime(p.Time)
+	return t, err == nil
+}
+
+func (p Point) Location() orb.Point {
+	return orb.Point{p.Lon, p.Lat}
+}
+
+// Note joins the textual fields of a waypoint into a single checkpoint note.
+func (p Point) Note() string {
+	parts := make([]string, 0, 3)
+	for _, s := range []string{p.Name, p.Desc, p.Cmt} {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (p Point) validate() error {
+	if p.Lat < -90 || p.Lat > 90 {
+		return fmt.Errorf("latitude %v out of range", p.Lat)
+	}
+	if p.Lon < -180 || p.Lon > 180 {
+		return fmt.Errorf("longitude %v out of range", p.Lon)
+	}
+	if p.Time != "" {
+		if _, err := parseTime(p.Time); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(v))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected ISO 8601 (e.g. 2024-05-01T08:30:00Z)", v)
+	}
+	return t, nil
+}
@@ -0,0 +1,160 @@
+package gpx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <metadata><name>Tour du Mont Blanc</name><time>2024-07-01T06:00:00Z</time></metadata>
+  <wpt lat="45.9237" lon="6.8694">
+    <time>2024-07-01T07:15:00+02:00</time>
+    <name>Chamonix</name>
+    <desc>Start</desc>
+    <cmt>Bakery on the left</cmt>
+  </wpt>
+  <trk>
+    <name>Day 1</name>
+    <desc>Les Houches to Les Contamines</desc>
+    <trkseg>
+      <trkpt lat="45.8906" lon="6.7983"><ele>1008</ele><time>2024-07-01T06:00:00Z</time></trkpt>
+      <trkpt lat="45.8601" lon="6.7592"><time>2024-07-01T07:00:00.5Z</time></trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="45.8213" lon="6.7278"/>
+    </trkseg>
+  </trk>
+</gpx>`
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if got := doc.Name(); got != "Tour du Mont Blanc" {
+		t.Errorf("Name = %q", got)
+	}
+	if got := doc.Description(); got != "Les Houches to Les Contamines" {
+		t.Errorf("Description = %q", got)
+	}
+	if start, ok := doc.StartTime(); !ok || !start.Equal(time.Date(2024, 7, 1, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("StartTime = %v, %v", start, ok)
+	}
+
+	points := doc.TrackPoints()
+	if len(points) != 3 {
+		t.Fatalf("TrackPoints = %d points, want 3 across both segments", len(points))
+	}
+	if points[0].Ele == nil || *points[0].Ele != 1008 {
+		t.Errorf("first point elevation = %v", points[0].Ele)
+	}
+	if loc := points[2].Location(); loc.Lon() != 6.7278 || loc.Lat() != 45.8213 {
+		t.Errorf("Location = %v, want lon/lat order", loc)
+	}
+	if ts, ok := points[1].Timestamp(); !ok || ts.Nanosecond() != 5e8 {
+		t.Errorf("fractional Timestamp = %v, %v", ts, ok)
+	}
+	if _, ok := points[2].Timestamp(); ok {
+		t.Error("Timestamp of a point without <time> should be unknown")
+	}
+
+	if len(doc.Waypoints) != 1 {
+		t.Fatalf("Waypoints = %d, want 1", len(doc.Waypoints))
+	}
+	w := doc.Waypoints[0]
+	if got := w.Note(); got != "Chamonix\nStart\nBakery on the left" {
+		t.Errorf("Note = %q", got)
+	}
+	if ts, ok := w.Timestamp(); !ok || !ts.Equal(time.Date(2024, 7, 1, 5, 15, 0, 0, time.UTC)) {
+		t.Errorf("waypoint Timestamp = %v, %v", ts, ok)
+	}
+}
+
+func TestParseFallbacks(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<gpx version="1.1">
+		<trk><name>Only the track</name><desc>Its description</desc>
+		<trkseg><trkpt lat="0" lon="0"/></trkseg></trk></gpx>`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if doc.Name() != "Only the track" || doc.Description() != "Its description" {
+		t.Errorf("Name, Description = %q, %q; want the track's", doc.Name(), doc.Description())
+	}
+	if _, ok := doc.StartTime(); ok {
+		t.Error("StartTime without metadata should be unknown")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		gpx  string
+		want string // Part of the message shown to the uploader
+	}{
+		{"empty", ``, "file is empty"},
+		{"malformed xml", "<gpx version=\"1.1\">\n<trk>\n</gpx>", "malformed XML on line 3"},
+		{"wrong root", `<kml><Document/></kml>`, "root element must be <gpx>"},
+		{"gpx 1.0", `<gpx version="1.0"><wpt lat="1" lon="1"/></gpx>`, `unsupported GPX version "1.0"`},
+		{"no version", `<gpx><wpt lat="1" lon="1"/></gpx>`, `unsupported GPX version ""`},
+		{"no points", `<gpx version="1.1"><trk><trkseg/></trk></gpx>`, "no waypoints or track points"},
+		{"bad metadata time", `<gpx version="1.1"><metadata><time>yesterday</time></metadata><wpt lat="1" lon="1"/></gpx>`, "metadata: invalid time"},
+		{"latitude out of range", `<gpx version="1.1"><wpt lat="91" lon="0"/></gpx>`, "waypoint 1: latitude 91 out of range"},
+		{"longitude out of range", `<gpx version="1.1"><wpt lat="0" lon="-180.5"/></gpx>`, "waypoint 1: longitude -180.5 out of range"},
+		{"non-numeric coordinate", `<gpx version="1.1"><wpt lat="north" lon="0"/></gpx>`, "could not read GPX"},
+		{
+			"bad track point time",
+			`<gpx version="1.1"><trk><trkseg><trkpt lat="0" lon="0"/></trkseg><trkseg><trkpt lat="0" lon="0"/><trkpt lat="0" lon="0"><time>01/07/2024</time></trkpt></trkseg></trk></gpx>`,
+			"track 1, segment 2, point 2: invalid time",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.gpx))
+			if err == nil {
+				t.Fatal("Parse succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	ele := 1008.0
+	doc := &Document{
+		Metadata:  &Metadata{Name: "Export", Time: "2024-07-01T06:00:00Z"},
+		Waypoints: []Point{{Lat: 45.9, Lon: 6.8, Name: "Camp", Time: "2024-07-01T18:00:00Z"}},
+		Tracks: []Track{{Segments: []Segment{{Points: []Point{
+			{Lat: 45.89, Lon: 6.79, Ele: &ele, Time: "2024-07-01T06:00:00Z"},
+			{Lat: 45.86, Lon: 6.75},
+		}}}}},
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, doc); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{`<?xml`, `xmlns="` + Namespace + `"`, `version="1.1"`, `creator="TrailStory"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("encoded GPX lacks %s:\n%s", want, out)
+		}
+	}
+
+	parsed, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse of encoded GPX: %v", err)
+	}
+	if len(parsed.TrackPoints()) != 2 || len(parsed.Waypoints) != 1 || parsed.Name() != "Export" {
+		t.Errorf("round trip lost data: %+v", parsed)
+	}
+	if p := parsed.TrackPoints()[0]; p.Ele == nil || *p.Ele != ele {
+		t.Errorf("round trip lost elevation: %+v", p)
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/gpx"
+	"github.com/Mahaveer86619/TrailStory/pkg/utils"
+	"github.com/Mahaveer86619/TrailStory/pkg/views"
+)
+
+func (s *JourneyService) ImportGPX(userID uint, file io.Reader, req views.ImportJourneyRequest) (*views.JourneyView, error) {
+	doc, err := gpx.Parse(file)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid GPX file: "+err.Error(), err)
+	}
+
+	imported := importedJourney{
+		Title:       doc.Name(),
+		Description: doc.Description(),
+	}
+	if t, ok := doc.StartTime(); ok {
+		imported.StartedAt = t
+	}
+
+	for _, p := range doc.TrackPoints() {
+		ts, _ := p.Timestamp()
+		imported.Track = append(imported.Track, &importedPoint{Location: p.Location(), Time: ts})
+	}
+	for _, p := range doc.Waypoints {
+		ts, _ := p.Timestamp()
+		imported.Waypoints = append(imported.Waypoints, &importedPoint{Location: p.Location(), Time: ts, Note: p.Note()})
+	}
+
+	journey, err := s.saveImportedJourney(userID, req, &imported, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetJourney(utils.MaskID(journey.ID), userID, views.JourneyOptions{})
+}
+
+// ExportGPX renders a journey as GPX: one waypoint per checkpoint and a single
+// track through all checkpoints in time order.
+func (s *JourneyService) ExportGPX(journeyMaskedID string, requesterID uint, w io.Writer) error {
+	journey, err := s.findVisibleJourney(journeyMaskedID, requesterID)
+	if err != nil {
+		return err
+	}
+
+	doc := &gpx.Document{
+		Metadata: &gpx.Metadata{
+			Name: journey.Title,
+			Desc: journey.Description,
+			Time: journey.StartedAt.UTC().Format(time.RFC3339),
+		},
+	}
+
+	segment := gpx.Segment{}
+	for i, cp := range journey.Checkpoints {
+		point := gpx.Point{
+			Lat:  cp.Location.Point.Lat(),
+			Lon:  cp.Location.Point.Lon(),
+			Time: cp.Timestamp.UTC().Format(time.RFC3339),
+		}
+		segment.Points = append(segment.Points, point)
+
+		point.Name = fmt.Sprintf("Checkpoint %d", i+1)
+		point.Desc = cp.Note
+		doc.Waypoints = append(doc.Waypoints, point)
+	}
+
+	if len(segment.Points) > 0 {
+		doc.Tracks = []gpx.Track{{Name: journey.Title, Segments: []gpx.Segment{segment}}}
+	}
+
+	if err := gpx.Encode(w, doc); err != nil {
+		return errz.New(errz.InternalServerError, "Failed to write GPX", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/services/exif"
+)
+
+type Variant struct {
+	Name    string
+	MaxSize int // Longest side in pixels
+}
+
+// Variants are ordered largest first; each is rendered from the previous one.
+var Variants = []Variant{
+	{Name: "full", MaxSize: 2048},
+	{Name: "medium", MaxSize: 800},
+	{Name: "thumb", MaxSize: 200},
+}
+
+type Rendition struct {
+	Variant
+	Ext  string // ".jpg", or ".png" when the image has transparency
+	Data []byte
+}
+
+// ErrUnsupported is returned for formats we cannot decode (video, HEIC, ...).
+var ErrUnsupported = errors.New("unsupported image format")
+
+// Anything larger is refused before decoding, to bound memory use.
+const maxPixels = 50_000_000
+
+const jpegQuality = 85
+
+// Render decodes an image once and encodes every variant, turned upright and
+// fitted within its MaxSize. Images are never enlarged. Metadata, including
+// the GPS position, is not carried over to the variants.
+func Render(data []byte) ([]Rendition, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, ErrUnsupported
+		}
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, errors.New("image dimensions are too large")
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	orientation := 1
+	if info, err := exif.Decode(bytes.NewReader(data)); err == nil {
+		orientation = info.Orientation
+	}
+
+	// Premultiplied RGBA so averaging treats transparent pixels correctly
+	current := image.NewRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+	draw.Draw(current, current.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	opaque := current.Opaque()
+
+	renditions := make([]Rendition, 0, len(Variants))
+	for i, v := range Variants {
+		w, h := fit(current.Bounds().Dx(), current.Bounds().Dy(), v.MaxSize)
+		current = resize(current, w, h)
+		if i == 0 {
+			current = orient(current, orientation)
+		}
+
+		r := Rendition{Variant: v}
+		var buf bytes.Buffer
+		if opaque {
+			r.Ext = ".jpg"
+			err = jpeg.Encode(&buf, current, &jpeg.Options{Quality: jpegQuality})
+		} else {
+			r.Ext = ".png"
+			err = png.Encode(&buf, current)
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.Data = buf.Bytes()
+		renditions = append(renditions, r)
+	}
+	return renditions, nil
+}
+
+func fit(w, h, maxSize int) (int, int) {
+	if w <= maxSize && h <= maxSize {
+		return w, h
+	}
+
+	scale := float64(maxSize) / float64(max(w, h))
+	return max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale)))
+}
+
+// resize shrinks src with a box filter: each target pixel is the average of
+// the source pixels it covers.
+func resize(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if w == sw && h == sh {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+
+			var sum [4]uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[src.PixOffset(x0, sy):src.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += uint32(row[i])
+					sum[1] += uint32(row[i+1])
+					sum[2] += uint32(row[i+2])
+					sum[3] += uint32(row[i+3])
+				}
+			}
+
+			n := uint32((y1 - y0) * (x1 - x0))
+			px := dst.Pix[dst.PixOffset(x, y):]
+			for c := 0; c < 4; c++ {
+				px[c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// orient applies a TIFF orientation (2-8) so the image displays upright.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 { // The 90 degree turns swap the sides
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored
+				dx, dy = w-1-x, y
+			case 3: // Upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // Upside down, mirrored
+				dx, dy = x, h-1-y
+			case 5: // Transposed
+				dx, dy = y, x
+			case 6: // Turned 90 degrees clockwise
+				dx, dy = h-1-y, x
+			case 7: // Transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // Turned 90 degrees counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):])
+		}
+	}
+	return dst
+}
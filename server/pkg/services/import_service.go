@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/views"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"gorm.io/gorm"
+)
+
+// importedJourney is the format-neutral result of parsing a track file.
+type importedJourney struct {
+	Title       string
+	Description string
+	StartedAt   time.Time // Zero if the file has no document time
+
+	Track     []*importedPoint // Recorded positions, thinned on import
+	Waypoints []*importedPoint // Named points, always kept
+}
+
+type importedPoint struct {
+	Location orb.Point
+	Time     time.Time // Zero if the file has no time for this point
+	Note     string
+
+	CheckpointID uint // Set once the checkpoint row is created
+}
+
+// saveImportedJourney creates the journey and its checkpoints in one
+// transaction and records the new checkpoint IDs on the imported points.
+// attach, if set, runs inside the same transaction once the IDs are known.
+func (s *JourneyService) saveImportedJourney(
+	userID uint,
+	req views.ImportJourneyRequest,
+	imported *importedJourney,
+	attach func(tx *gorm.DB, journey *models.Journey) error,
+) (*models.Journey, error) {
+	track := thinPoints(imported.Track, req.ThinMeters)
+	fillTimestamps(imported, track)
+
+	points := make([]*importedPoint, 0, len(track)+len(imported.Waypoints))
+	points = append(points, track...)
+	points = append(points, imported.Waypoints...)
+	if len(points) == 0 {
+		return nil, errz.New(errz.BadRequest, "File contains no points to import", nil)
+	}
+
+	title := req.Title
+	if title == "" {
+		title = imported.Title
+	}
+	if title == "" {
+		title = "Imported track"
+	}
+
+	journey := models.Journey{
+		UserID:      userID,
+		Title:       title,
+		Description: imported.Description,
+		IsPublic:    req.IsPublic,
+		StartedAt:   points[0].Time,
+	}
+
+	// A recorded track is a finished trip; span it over the first and last fix
+	endedAt := points[0].Time
+	for _, p := range points {
+		if p.Time.Before(journey.StartedAt) {
+			journey.StartedAt = p.Time
+		}
+		if p.Time.After(endedAt) {
+			endedAt = p.Time
+		}
+	}
+	journey.EndedAt = &endedAt
+
+	checkpoints := make([]models.Checkpoint, len(points))
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&journey).Error; err != nil {
+			return err
+		}
+		for i, p := range points {
+			checkpoints[i] = models.Checkpoint{
+				JourneyID: journey.ID,
+				Location:  models.GeoPoint{Point: p.Location},
+				Timestamp: p.Time,
+				Note:      p.Note,
+			}
+		}
+		if err := tx.CreateInBatches(&checkpoints, 500).Error; err != nil {
+			return err
+		}
+
+		for i, p := range points {
+			p.CheckpointID = checkpoints[i].ID
+		}
+		journey.Checkpoints = checkpoints
+
+		if attach != nil {
+			return attach(tx, &journey)
+		}
+		return nil
+	})
+	if err != nil {
+		var bkErr *errz.BooktureError
+		if errors.As(err, &bkErr) {
+			return nil, err
+		}
+		return nil, errz.New(errz.InternalServerError, "Failed to import journey", err)
+	}
+
+	s.resolvePlacesAsync(checkpoints)
+	return &journey, nil
+}
+
+// thinPoints drops points closer than minDistance meters to the last kept
+// point. The first and last points are always kept.
+func thinPoints(points []*importedPoint, minDistance float64) []*importedPoint {
+	if minDistance <= 0 || len(points) < 3 {
+		return points
+	}
+
+	kept := []*importedPoint{points[0]}
+	for _, p := range points[1 : len(points)-1] {
+		if geo.Distance(kept[len(kept)-1].Location, p.Location) >= minDistance {
+			kept = append(kept, p)
+		}
+	}
+	return append(kept, points[len(points)-1])
+}
+
+// fillTimestamps gives every point without a time a sensible one. Track points
+// inherit the previous fix so their order is preserved; waypoints take the time
+// of the closest track point, since that is when the user was there.
+func fillTimestamps(imported *importedJourney, track []*importedPoint) {
+	fallback := imported.StartedAt
+	if fallback.IsZero() {
+		fallback = time.Now()
+	}
+
+	for _, p := range track {
+		if p.Time.IsZero() {
+			p.Time = fallback
+		}
+		fallback = p.Time
+	}
+
+	for _, w := range imported.Waypoints {
+		if !w.Time.IsZero() {
+			continue
+		}
+		w.Time = fallback
+
+		best := -1.0
+		for _, p := range track {
+			if d := geo.Distance(w.Location, p.Location); best < 0 || d < best {
+				best = d
+				w.Time = p.Time
+			}
+		}
+	}
+}
@@ -1,29 +1,57 @@
 package services
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/Mahaveer86619/TrailStory/pkg/config"
 	"github.com/Mahaveer86619/TrailStory/pkg/db"
 	"github.com/Mahaveer86619/TrailStory/pkg/errz"
 	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/geocoder"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/live"
 	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/upload"
 	"github.com/Mahaveer86619/TrailStory/pkg/utils"
 	"github.com/Mahaveer86619/TrailStory/pkg/views"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
 
 	"gorm.io/gorm"
 )
 
+// SQLSTATE of a unique constraint violation.
+const uniqueViolation = "23505"
+
 type JourneyService struct {
-	DB      *gorm.DB
-	Storage storage.StorageService
+	DB          *gorm.DB
+	Storage     storage.StorageService
+	Geocoder    geocoder.Geocoder
+	Live        *live.Hub
+	Deduplicate bool // Store media under content hashes, see storeContent
+
+	places chan models.Checkpoint // Waiting for reverse geocoding
 }
 
-func NewJourneyService(storage storage.StorageService) *JourneyService {
-	return &JourneyService{
-		DB:      db.GetTrailStoryDB().DB,
-		Storage: storage,
+func NewJourneyService(storage storage.StorageService, geocoder geocoder.Geocoder) *JourneyService {
+	s := &JourneyService{
+		DB:          db.GetTrailStoryDB().DB,
+		Storage:     storage,
+		Geocoder:    geocoder,
+		Live:        live.NewHub(),
+		Deduplicate: config.AppConfig.STORAGE_DEDUPLICATE == "true",
+		places:      make(chan models.Checkpoint, placeQueueSize),
 	}
+	go s.resolvePlaces()
+	return s
 }
 
 // --- Journey Operations ---
@@ -45,7 +73,22 @@ func (s *JourneyService) CreateJourney(userID uint, req views.CreateJourneyReque
 	return &view, nil
 }
 
-func (s *JourneyService) GetJourney(journeyMaskedID string, requesterID uint) (*views.JourneyView, error) {
+func (s *JourneyService) GetJourney(journeyMaskedID string, requesterID uint, opts views.JourneyOptions) (*views.JourneyView, error) {
+	journey, err := s.findVisibleJourney(journeyMaskedID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.toJourneyViews([]models.Journey{*journey}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+// findVisibleJourney loads a journey with its checkpoints and media, enforcing
+// that private journeys are only visible to their owner.
+func (s *JourneyService) findVisibleJourney(journeyMaskedID string, requesterID uint) (*models.Journey, error) {
 	journeyID, err := utils.UnmaskID(journeyMaskedID)
 	if err != nil {
 		return nil, errz.New(errz.BadRequest, "Invalid Journey ID", err)
@@ -55,9 +98,7 @@ func (s *JourneyService) GetJourney(journeyMaskedID string, requesterID uint) (*
 
 	// Preload Checkpoints and Media
 	// We use ST_AsText to ensure our Scanner receives the format it expects if hex isn't default
-	err = s.DB.Preload("Checkpoints", func(db *gorm.DB) *gorm.DB {
-		return db.Select("*, ST_AsText(location) as location").Order("timestamp asc").Preload("Media")
-	}).First(&journey, journeyID).Error
+	err = s.DB.Scopes(preloadCheckpoints).First(&journey, journeyID).Error
 
 	if err != nil {
 		return nil, errz.New(errz.NotFound, "Journey not found", err)
@@ -68,37 +109,84 @@ func (s *JourneyService) GetJourney(journeyMaskedID string, requesterID uint) (*
 		return nil, errz.New(errz.Forbidden, "This journey is private", nil)
 	}
 
-	view := views.ToJourneyView(&journey, s.Storage)
-	return &view, nil
+	return &journey, nil
 }
 
+func (s *JourneyService) GetJourneyGeoJSON(journeyMaskedID string, requesterID uint, opts views.JourneyOptions) (*geojson.FeatureCollection, error) {
+	journey, err := s.findVisibleJourney(journeyMaskedID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toFeatureCollection([]models.Journey{*journey}, opts), nil
+}
+
+// ListUserJourneys returns summaries; the checkpoints are only loaded by
+// GetJourney.
 func (s *JourneyService) ListUserJourneys(userID uint) ([]views.JourneyView, error) {
+	journeys, err := s.findUserJourneys(userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toJourneySummaries(journeys)
+}
+
+func (s *JourneyService) ListUserJourneysGeoJSON(userID uint, opts views.JourneyOptions) (*geojson.FeatureCollection, error) {
+	journeys, err := s.findUserJourneys(userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toFeatureCollection(journeys, opts), nil
+}
+
+func (s *JourneyService) findUserJourneys(userID uint, withCheckpoints bool) ([]models.Journey, error) {
 	var journeys []models.Journey
 
-	err := s.DB.Where("user_id = ?", userID).
-		Preload("Checkpoints", func(db *gorm.DB) *gorm.DB {
-			return db.Select("*, ST_AsText(location) as location").Order("timestamp asc").Preload("Media")
-		}).
-		Order("created_at desc").
+	query := s.DB.Where("user_id = ?", userID)
+	if withCheckpoints {
+		query = query.Scopes(preloadCheckpoints)
+	}
+	err := query.Order("created_at desc").
 		Find(&journeys).Error
 
 	if err != nil {
 		return nil, errz.New(errz.InternalServerError, "Failed to fetch journeys", err)
 	}
 
-	return views.ToListJourneyView(journeys, s.Storage), nil
+	return journeys, nil
 }
 
+// ListPublicJourneys returns summaries, like ListUserJourneys.
 func (s *JourneyService) ListPublicJourneys(page, limit int) ([]views.JourneyView, error) {
+	journeys, err := s.findPublicJourneys(page, limit, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toJourneySummaries(journeys)
+}
+
+func (s *JourneyService) ListPublicJourneysGeoJSON(page, limit int, opts views.JourneyOptions) (*geojson.FeatureCollection, error) {
+	journeys, err := s.findPublicJourneys(page, limit, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toFeatureCollection(journeys, opts), nil
+}
+
+func (s *JourneyService) findPublicJourneys(page, limit int, withCheckpoints bool) ([]models.Journey, error) {
 	var journeys []models.Journey
 	offset := (page - 1) * limit
 
 	// Fetch public journeys, ordered by newest first, with pagination
-	err := s.DB.Where("is_public = ?", true).
-		Preload("Checkpoints", func(db *gorm.DB) *gorm.DB {
-			return db.Select("*, ST_AsText(location) as location").Order("timestamp asc").Preload("Media")
-		}).
-		Order("created_at desc").
+	query := s.DB.Where("is_public = ?", true)
+	if withCheckpoints {
+		query = query.Scopes(preloadCheckpoints)
+	}
+	err := query.Order("created_at desc").
 		Limit(limit).
 		Offset(offset).
 		Find(&journeys).Error
@@ -107,7 +195,7 @@ func (s *JourneyService) ListPublicJourneys(page, limit int) ([]views.JourneyVie
 		return nil, errz.New(errz.InternalServerError, "Failed to fetch public feed", err)
 	}
 
-	return views.ToListJourneyView(journeys, s.Storage), nil
+	return journeys, nil
 }
 
 func (s *JourneyService) DeleteJourney(userID uint, journeyMaskedID string) error {
@@ -116,16 +204,117 @@ func (s *JourneyService) DeleteJourney(userID uint, journeyMaskedID string) erro
 		return errz.New(errz.BadRequest, "Invalid Journey ID", err)
 	}
 
-	result := s.DB.Where("id = ? AND user_id = ?", journeyID, userID).Delete(&models.Journey{})
-	if result.Error != nil {
-		return errz.New(errz.InternalServerError, "Failed to delete journey", result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return errz.New(errz.NotFound, "Journey not found or unauthorized", nil)
+	// Checkpoints and media are soft-deleted along with the journey, so no
+	// query can find rows whose files are being released
+	var keys []string
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", journeyID, userID).Delete(&models.Journey{})
+		if result.Error != nil {
+			return errz.New(errz.InternalServerError, "Failed to delete journey", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errz.New(errz.NotFound, "Journey not found or unauthorized", nil)
+		}
+
+		if keys, err = checkpointMediaKeys(tx, "checkpoints.journey_id = ?", journeyID); err != nil {
+			return errz.New(errz.InternalServerError, "Failed to delete journey", err)
+		}
+		checkpoints := tx.Model(&models.Checkpoint{}).Select("id").Where("journey_id = ?", journeyID)
+		if err := tx.Where("checkpoint_id IN (?)", checkpoints).Delete(&models.Media{}).Error; err != nil {
+			return errz.New(errz.InternalServerError, "Failed to delete journey", err)
+		}
+		if err := tx.Where("journey_id = ?", journeyID).Delete(&models.Checkpoint{}).Error; err != nil {
+			return errz.New(errz.InternalServerError, "Failed to delete journey", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	s.closeLive(journeyID)
+
+	go s.releaseMedia(keys)
 	return nil
 }
 
+func (s *JourneyService) UpdateJourney(userID uint, journeyMaskedID string, req views.UpdateJourneyRequest) (*views.JourneyView, error) {
+	journeyID, err := utils.UnmaskID(journeyMaskedID)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid Journey ID", err)
+	}
+
+	journey, err := s.findOwnedJourney(userID, journeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only touch the fields present in the request
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		updates["title"] = *req.Title
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.IsPublic != nil {
+		updates["is_public"] = *req.IsPublic
+	}
+
+	if len(updates) > 0 {
+		if err := s.DB.Model(journey).Updates(updates).Error; err != nil {
+			return nil, errz.New(errz.InternalServerError, "Failed to update journey", err)
+		}
+	}
+	if req.IsPublic != nil && !*req.IsPublic {
+		s.closeLive(journey.ID)
+	}
+
+	return s.GetJourney(journeyMaskedID, userID, views.JourneyOptions{})
+}
+
+func (s *JourneyService) FinishJourney(userID uint, journeyMaskedID string) (*views.JourneyView, error) {
+	journeyID, err := utils.UnmaskID(journeyMaskedID)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid Journey ID", err)
+	}
+
+	journey, err := s.findOwnedJourney(userID, journeyID)
+	if err != nil {
+		return nil, err
+	}
+	if journey.EndedAt != nil {
+		return nil, errz.New(errz.Conflict, "Journey is already completed", nil)
+	}
+
+	if err := s.DB.Model(journey).Update("ended_at", time.Now()).Error; err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to finish journey", err)
+	}
+	s.publishCompleted(journey.ID)
+
+	return s.GetJourney(journeyMaskedID, userID, views.JourneyOptions{})
+}
+
+func (s *JourneyService) ReopenJourney(userID uint, journeyMaskedID string) (*views.JourneyView, error) {
+	journeyID, err := utils.UnmaskID(journeyMaskedID)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid Journey ID", err)
+	}
+
+	journey, err := s.findOwnedJourney(userID, journeyID)
+	if err != nil {
+		return nil, err
+	}
+	if journey.EndedAt == nil {
+		return nil, errz.New(errz.Conflict, "Journey is still ongoing", nil)
+	}
+
+	if err := s.DB.Model(journey).Update("ended_at", nil).Error; err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to reopen journey", err)
+	}
+
+	return s.GetJourney(journeyMaskedID, userID, views.JourneyOptions{})
+}
+
 // --- Checkpoint Operations ---
 
 func (s *JourneyService) AddCheckpoint(userID uint, journeyMaskedID string, req views.CreateCheckpointRequest) (*views.CheckpointView, error) {
@@ -134,13 +323,8 @@ func (s *JourneyService) AddCheckpoint(userID uint, journeyMaskedID string, req
 		return nil, errz.New(errz.BadRequest, "Invalid Journey ID", err)
 	}
 
-	// Verify Ownership
-	var journey models.Journey
-	if err := s.DB.First(&journey, journeyID).Error; err != nil {
-		return nil, errz.New(errz.NotFound, "Journey not found", err)
-	}
-	if journey.UserID != userID {
-		return nil, errz.New(errz.Forbidden, "Not authorized to edit this journey", nil)
+	if _, err := s.findOwnedJourney(userID, journeyID); err != nil {
+		return nil, err
 	}
 
 	ts := time.Now()
@@ -160,8 +344,10 @@ func (s *JourneyService) AddCheckpoint(userID uint, journeyMaskedID string, req
 	if err := s.DB.Create(&cp).Error; err != nil {
 		return nil, errz.New(errz.InternalServerError, "Failed to add checkpoint", err)
 	}
+	s.publishCheckpoint(&cp)
+	s.resolvePlacesAsync([]models.Checkpoint{cp})
 
-	view := views.ToCheckpointView(&cp, s.Storage)
+	view := views.ToCheckpointView(&cp, s.checkpointStorage(cp.JourneyID))
 	return &view, nil
 }
 
@@ -171,18 +357,366 @@ func (s *JourneyService) DeleteCheckpoint(userID uint, checkpointMaskedID string
 		return errz.New(errz.BadRequest, "Invalid Checkpoint ID", err)
 	}
 
+	cp, err := s.findOwnedCheckpoint(userID, checkpointID)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if keys, err = checkpointMediaKeys(tx, "checkpoints.id = ?", cp.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("checkpoint_id = ?", cp.ID).Delete(&models.Media{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(cp).Error
+	})
+	if err != nil {
+		return errz.New(errz.InternalServerError, "Failed to delete checkpoint", err)
+	}
+
+	go s.releaseMedia(keys)
+	return nil
+}
+
+func (s *JourneyService) UpdateCheckpoint(userID uint, checkpointMaskedID string, req views.UpdateCheckpointRequest) (*views.CheckpointView, error) {
+	checkpointID, err := utils.UnmaskID(checkpointMaskedID)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid Checkpoint ID", err)
+	}
+
+	cp, err := s.findOwnedCheckpoint(userID, checkpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	if (req.Lat == nil) != (req.Lng == nil) {
+		return nil, errz.New(errz.BadRequest, "lat and lng must be provided together", nil)
+	}
+
+	updates := map[string]interface{}{}
+	if req.Note != nil {
+		updates["note"] = *req.Note
+	}
+	if req.Lat != nil {
+		cp.Location = models.GeoPoint{Point: orb.Point{*req.Lng, *req.Lat}}
+		updates["location"] = cp.Location
+		// The old place no longer applies; the new one is resolved later
+		for column, value := range placeColumns(models.Place{}) {
+			updates[column] = value
+		}
+	}
+	if req.Timestamp != nil {
+		ts, err := time.Parse(time.RFC3339, *req.Timestamp)
+		if err != nil {
+			return nil, errz.New(errz.BadRequest, "Timestamp must be RFC3339", err)
+		}
+		updates["timestamp"] = ts
+	}
+	if req.JourneyID != nil {
+		// Moving is only allowed between journeys of the same owner
+		targetID, err := utils.UnmaskID(*req.JourneyID)
+		if err != nil {
+			return nil, errz.New(errz.BadRequest, "Invalid target Journey ID", err)
+		}
+		if _, err := s.findOwnedJourney(userID, targetID); err != nil {
+			return nil, err
+		}
+		updates["journey_id"] = targetID
+	}
+
+	if len(updates) > 0 {
+		if err := s.DB.Model(cp).Updates(updates).Error; err != nil {
+			// The target journey already has a checkpoint with this client_id
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+				return nil, errz.New(errz.Conflict, "Target journey already has a checkpoint with this client_id", err)
+			}
+			return nil, errz.New(errz.InternalServerError, "Failed to update checkpoint", err)
+		}
+	}
+	if req.Lat != nil {
+		s.resolvePlacesAsync([]models.Checkpoint{*cp})
+	}
+
+	return s.getCheckpointView(cp.ID)
+}
+
+// --- Media Operations ---
+
+func (s *JourneyService) UploadCheckpointMedia(userID uint, checkpointMaskedID string, files []*multipart.FileHeader) (*views.CheckpointView, error) {
+	checkpointID, err := utils.UnmaskID(checkpointMaskedID)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid Checkpoint ID", err)
+	}
+
+	if len(files) == 0 {
+		return nil, errz.New(errz.BadRequest, "At least one media file is required", nil)
+	}
+
+	cp, err := s.findOwnedCheckpoint(userID, checkpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, header := range files {
+		total += header.Size
+	}
+	if err := checkQuota(s.DB, userID, total); err != nil {
+		return nil, err
+	}
+
+	// Inspect every file before storing any, so one rejected file does not
+	// leave the others half uploaded
+	opened := make([]*upload.File, 0, len(files))
+	defer func() {
+		for _, file := range opened {
+			file.Close()
+		}
+	}()
+	for _, header := range files {
+		file, err := upload.MediaPolicy.Open(header)
+		if err != nil {
+			return nil, uploadError(header.Filename, err)
+		}
+		opened = append(opened, file)
+	}
+
+	stored := make([]*models.Media, 0, len(files))
+	for i, file := range opened {
+		media, err := s.storeMedia(cp.JourneyID, cp.ID, files[i].Filename, file)
+		if err != nil {
+			go s.discardMedia(stored)
+			return nil, err
+		}
+		stored = append(stored, media)
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := reserveQuota(tx, userID, storedBytes(stored)); err != nil {
+			return err
+		}
+		if err := tx.Create(&stored).Error; err != nil {
+			return errz.New(errz.InternalServerError, "Failed to record media", err)
+		}
+		return nil
+	})
+	if err != nil {
+		go s.discardMedia(stored)
+		return nil, err
+	}
+
+	return s.getCheckpointView(cp.ID)
+}
+
+// discardMedia deletes the stored files of media that were never recorded.
+// Deduplicated files may be shared, so it goes through releaseMedia, which
+// leaves those just written to the garbage collector.
+func (s *JourneyService) discardMedia(media []*models.Media) {
+	var keys []string
+	for _, m := range media {
+		keys = append(keys, storedKeys(m.URL, m.Variants)...)
+	}
+	s.releaseMedia(keys)
+}
+
+// --- Helpers ---
+
+// toJourneyViews converts journeys to views, applying the requested
+// simplification and attaching server-computed statistics.
+func (s *JourneyService) toJourneyViews(journeys []models.Journey, opts views.JourneyOptions) ([]views.JourneyView, error) {
+	simplified := make([]*views.SimplificationView, len(journeys))
+	for i := range journeys {
+		simplified[i] = simplifyJourney(&journeys[i], opts.SimplifyM)
+	}
+
+	list := views.ToListJourneyView(journeys, s.Storage)
+	for i := range list {
+		list[i].Simplification = simplified[i]
+	}
+
+	if err := s.attachStats(journeys, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *JourneyService) toFeatureCollection(journeys []models.Journey, opts views.JourneyOptions) *geojson.FeatureCollection {
+	dropped := 0
+	for i := range journeys {
+		if info := simplifyJourney(&journeys[i], opts.SimplifyM); info != nil {
+			dropped += info.DroppedPoints
+		}
+	}
+
+	fc := views.ToListJourneyFeatureCollection(journeys, s.Storage)
+	if opts.SimplifyM > 0 {
+		fc.ExtraMembers = geojson.Properties{
+			"simplify_tolerance_m": opts.SimplifyM,
+			"dropped_points":       dropped,
+		}
+	}
+	return fc
+}
+
+// preloadCheckpoints loads the checkpoints of journeys in time order, with
+// their media. Only endpoints that render the checkpoints use it.
+func preloadCheckpoints(db *gorm.DB) *gorm.DB {
+	return db.Preload("Checkpoints", func(db *gorm.DB) *gorm.DB {
+		return db.Select("*, ST_AsText(location) as location").Order("timestamp asc, id asc").Preload("Media")
+	})
+}
+
+// findOwnedJourney loads a journey and verifies it belongs to userID.
+func (s *JourneyService) findOwnedJourney(userID, journeyID uint) (*models.Journey, error) {
+	var journey models.Journey
+	if err := s.DB.First(&journey, journeyID).Error; err != nil {
+		return nil, errz.New(errz.NotFound, "Journey not found", err)
+	}
+	if journey.UserID != userID {
+		return nil, errz.New(errz.Forbidden, "Not authorized to edit this journey", nil)
+	}
+	return &journey, nil
+}
+
+// findOwnedCheckpoint loads a checkpoint only if its journey belongs to userID.
+func (s *JourneyService) findOwnedCheckpoint(userID, checkpointID uint) (*models.Checkpoint, error) {
 	// Verify ownership via Join
 	var cp models.Checkpoint
-	err = s.DB.Joins("JOIN journeys ON journeys.id = checkpoints.journey_id").
+	err := s.DB.Joins("JOIN journeys ON journeys.id = checkpoints.journey_id").
 		Where("checkpoints.id = ? AND journeys.user_id = ?", checkpointID, userID).
 		First(&cp).Error
 
 	if err != nil {
-		return errz.New(errz.NotFound, "Checkpoint not found or unauthorized", err)
+		return nil, errz.New(errz.NotFound, "Checkpoint not found or unauthorized", err)
 	}
+	return &cp, nil
+}
 
-	if err := s.DB.Delete(&cp).Error; err != nil {
-		return errz.New(errz.InternalServerError, "Failed to delete checkpoint", err)
+func (s *JourneyService) getCheckpointView(checkpointID uint) (*views.CheckpointView, error) {
+	var cp models.Checkpoint
+	err := s.DB.Select("*, ST_AsText(location) as location").
+		Preload("Media").
+		First(&cp, checkpointID).Error
+	if err != nil {
+		return nil, errz.New(errz.NotFound, "Checkpoint not found", err)
+	}
+
+	view := views.ToCheckpointView(&cp, s.checkpointStorage(cp.JourneyID))
+	return &view, nil
+}
+
+// checkpointStorage is the storage to render a checkpoint's media with: URLs
+// are signed unless its journey is public.
+func (s *JourneyService) checkpointStorage(journeyID uint) storage.StorageService {
+	var journey models.Journey
+	if err := s.DB.Select("is_public").First(&journey, journeyID).Error; err != nil {
+		// Sign when unsure; a signed URL works either way
+		return views.MediaStorage(false, s.Storage)
+	}
+	return views.MediaStorage(journey.IsPublic, s.Storage)
+}
+
+// IsPublicMedia reports whether a stored file may be served without a signed
+// URL: avatars, and the media of public journeys with their variants.
+func (s *JourneyService) IsPublicMedia(storageKey string) bool {
+	if strings.HasPrefix(storageKey, "users/") {
+		return true
+	}
+
+	var count int64
+	err := s.DB.Model(&models.Media{}).
+		Joins("JOIN checkpoints ON checkpoints.id = media.checkpoint_id").
+		Joins("JOIN journeys ON journeys.id = checkpoints.journey_id").
+		Where("journeys.is_public AND journeys.deleted_at IS NULL").
+		Where("? IN (media.url, media.url_thumb, media.url_medium, media.url_full)", storageKey).
+		Count(&count).Error
+	return err == nil && count > 0
+}
+
+// storeMedia saves a validated upload, and the variants of an image, and
+// returns the Media row to insert.
+func (s *JourneyService) storeMedia(journeyID, checkpointID uint, filename string, file *upload.File) (*models.Media, error) {
+	var body io.Reader = file
+	var data []byte
+	if file.Kind == upload.KindImage {
+		// Images are bounded small enough to hold; variants render from memory
+		var err error
+		if data, err = io.ReadAll(file); err != nil {
+			return nil, uploadError(filename, err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	if s.Deduplicate {
+		return s.storeContent(checkpointID, filename, file, data)
+	}
+
+	key, err := s.Storage.SaveMedia(fmt.Sprint(journeyID), fmt.Sprint(checkpointID), filename, body)
+	if err != nil {
+		if errors.Is(err, upload.ErrTooLarge) {
+			return nil, uploadError(filename, err)
+		}
+		return nil, errz.New(errz.InternalServerError, "Failed to save media", err)
+	}
+
+	media := &models.Media{
+		CheckpointID: checkpointID,
+		URL:          key,
+		Filename:     uploadedName(filename),
+		Type:         file.Kind,
+		ContentType:  file.ContentType,
+		SizeBytes:    file.Size(),
+	}
+	if data != nil {
+		if media.Variants, err = s.saveMediaVariants(journeyID, checkpointID, filename, data); err != nil {
+			deleteStored(s.Storage, []string{key})
+			return nil, errz.New(errz.InternalServerError, "Failed to save media", err)
+		}
+	}
+	return media, nil
+}
+
+// uploadedName keeps the base of a client file name, for display only.
+func uploadedName(filename string) string {
+	name := filepath.Base(filepath.FromSlash(strings.ReplaceAll(filename, `\`, "/")))
+	if name == "." || name == "/" {
+		return ""
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return strings.ToValidUTF8(name, "")
+}
+
+// uploadError reports a rejected upload to the client, naming the file.
+func uploadError(filename string, err error) error {
+	switch {
+	case errors.Is(err, upload.ErrTooLarge):
+		return errz.New(errz.PayloadTooLarge, fmt.Sprintf("%s: %v", filename, err), err)
+	case errors.Is(err, upload.ErrUnsupportedType):
+		return errz.New(errz.UnsupportedMedia, fmt.Sprintf("%s: %v", filename, err), err)
+	default:
+		return errz.New(errz.BadRequest, "Failed to read uploaded file", err)
+	}
+}
+
+// mediaTypeFor guesses "image" or "video" from a declared type or the file
+// extension, "" otherwise. Only a hint for picking archive entries; uploads
+// are validated from their bytes by the upload package.
+func mediaTypeFor(contentType, filename string) string {
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return "image"
+	case strings.HasPrefix(contentType, "video/"):
+		return "video"
+	default:
+		return ""
 	}
-	return nil
 }
@@ -0,0 +1,499 @@
+package kml
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+)
+
+/*
+
+Supported subset of KML 2.2 ->
+
+<kml xmlns="http://www.opengis.net/kml/2.2">
+  <Document><name/><description/>
+    <Placemark><name/><description/>
+      <TimeStamp><when/></TimeStamp>
+      <Point><coordinates>lng,lat[,alt]</coordinates></Point>
+      | <LineString><coordinates>lng,lat lng,lat ...</coordinates></LineString>
+      | <gx:Track><when/>...<gx:coord>lng lat alt</gx:coord>...</gx:Track>
+    </Placemark>
+  </Document>
+</kml>
+
+Placemarks may be nested in any number of <Folder>s.
+
+*/
+
+const Namespace = "http://www.opengis.net/kml/2.2"
+
+// Document is the flattened content of a KML file.
+type Document struct {
+	Name        string
+	Description string
+	Placemarks  []Placemark
+}
+
+type Placemark struct {
+	Name        string
+	Description string
+	Points      []Point // One entry for <Point>, many for <LineString>/<gx:Track>
+	IsPath      bool
+}
+
+type Point struct {
+	Location orb.Point
+	Time     time.Time // Zero when the file has no time for this point
+}
+
+// Archive is a parsed KMZ: the main KML document plus the files its
+// placemarks reference, keyed by their path inside the archive.
+type Archive struct {
+	Document *Document
+	Files    map[string][]byte
+}
+
+// --- Decoding ---
+
+type rawPlacemark struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description"`
+	When        string         `xml:"TimeStamp>when"`
+	Point       *rawPoint      `xml:"Point"`
+	LineString  *rawLineString `xml:"LineString"`
+	Track       *rawTrack      `xml:"Track"`
+	Multi       *rawMulti      `xml:"MultiGeometry"`
+}
+
+type rawPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type rawLineString struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type rawTrack struct {
+	When  []string `xml:"when"`
+	Coord []string `xml:"coord"`
+}
+
+type rawMulti struct {
+	Points      []rawPoint      `xml:"Point"`
+	LineStrings []rawLineString `xml:"LineString"`
+	Tracks      []rawTrack      `xml:"Track"`
+}
+
+// Parse decodes a KML document. The returned errors are meant to be shown to
+// the uploader as-is.
+func Parse(r io.Reader) (*Document, error) {
+	dec := xml.NewDecoder(r)
+	doc := &Document{}
+	sawRoot := false
+	depth := 0
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return nil, fmt.Errorf("malformed XML on line %d: %s", syntaxErr.Line, syntaxErr.Msg)
+			}
+			return nil, fmt.Errorf("could not read KML: %v", err)
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if !sawRoot {
+				if el.Name.Local != "kml" {
+					return nil, errors.New("root element must be <kml>")
+				}
+				sawRoot = true
+				continue
+			}
+
+			switch el.Name.Local {
+			case "Placemark":
+				var raw rawPlacemark
+				if err := dec.DecodeElement(&raw, &el); err != nil {
+					return nil, fmt.Errorf("placemark %d: %v", len(doc.Placemarks)+1, err)
+				}
+				depth--
+
+				pms, err := raw.flatten()
+				if err != nil {
+					return nil, fmt.Errorf("placemark %d (%s): %v", len(doc.Placemarks)+1, raw.Name, err)
+				}
+				doc.Placemarks = append(doc.Placemarks, pms...)
+			case "name", "description":
+				// Only the first <Document>/<Folder> level names the journey
+				if depth != 3 {
+					continue
+				}
+				var text string
+				if err := dec.DecodeElement(&text, &el); err != nil {
+					return nil, fmt.Errorf("could not read <%s>: %v", el.Name.Local, err)
+				}
+				depth--
+				if el.Name.Local == "name" && doc.Name == "" {
+					doc.Name = strings.TrimSpace(text)
+				}
+				if el.Name.Local == "description" && doc.Description == "" {
+					doc.Description = strings.TrimSpace(text)
+				}
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	if !sawRoot {
+		return nil, errors.New("file is empty")
+	}
+	if len(doc.Placemarks) == 0 {
+		return nil, errors.New("file contains no placemarks with a Point, LineString or gx:Track")
+	}
+
+	return doc, nil
+}
+
+// Limits on what a KMZ may expand to, so a small archive cannot exhaust
+// memory. Sizes declared in the zip are checked first and reads are capped
+// in case they lie.
+const (
+	MaxDocumentBytes = 16 << 20  // The main .kml document
+	MaxEntryBytes    = 25 << 20  // Each referenced photo
+	MaxArchiveBytes  = 200 << 20 // Everything read from one archive
+)
+
+// ParseKMZ opens a KMZ archive. The main document is doc.kml, or the first
+// .kml file at the root if there is none. Only the photos its point
+// placemarks reference are read; other entries are ignored.
+func ParseKMZ(r io.Reader) (*Archive, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not read KMZ: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("file is not a valid KMZ (zip) archive")
+	}
+
+	entries := map[string]*zip.File{}
+	var mainKML string
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		name := path.Clean(f.Name)
+		entries[name] = f
+
+		isRootKML := !strings.Contains(name, "/") && strings.EqualFold(path.Ext(name), ".kml")
+		if name == "doc.kml" || (isRootKML && mainKML == "") {
+			mainKML = name
+		}
+	}
+
+	if mainKML == "" {
+		return nil, errors.New("KMZ archive contains no .kml document")
+	}
+
+	budget := int64(MaxArchiveBytes)
+	content, err := readEntry(entries[mainKML], MaxDocumentBytes, &budget)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", mainKML, err)
+	}
+
+	archive := &Archive{Document: doc, Files: map[string][]byte{}}
+	for _, pm := range doc.Placemarks {
+		if pm.IsPath {
+			continue
+		}
+		for _, ref := range pm.ImageRefs() {
+			f, ok := entries[ref]
+			if _, done := archive.Files[ref]; !ok || done || ref == mainKML {
+				continue
+			}
+			if archive.Files[ref], err = readEntry(f, MaxEntryBytes, &budget); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return archive, nil
+}
+
+// readEntry reads one archive entry of at most limit bytes, taking what it
+// read from the budget shared by the whole archive.
+func readEntry(f *zip.File, maxBytes int64, budget *int64) ([]byte, error) {
+	limit := min(maxBytes, *budget)
+	if f.UncompressedSize64 > uint64(limit) {
+		return nil, tooLarge(f.Name, maxBytes)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s in archive: %v", f.Name, err)
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s in archive: %v", f.Name, err)
+	}
+	if int64(len(content)) > limit {
+		return nil, tooLarge(f.Name, maxBytes)
+	}
+
+	*budget -= int64(len(content))
+	return content, nil
+}
+
+func tooLarge(name string, maxBytes int64) error {
+	return fmt.Errorf("%s in archive is too large: limited to %d MB, and %d MB for the whole archive", name, maxBytes>>20, MaxArchiveBytes>>20)
+}
+
+var imgSrcPattern = regexp.MustCompile(`(?i)<img[^>]+src\s*=\s*["']([^"']+)["']`)
+
+// ImageRefs returns the archive paths of images referenced from the
+// placemark description via <img src="...">.
+func (p Placemark) ImageRefs() []string {
+	var refs []string
+	for _, m := range imgSrcPattern.FindAllStringSubmatch(p.Description, -1) {
+		refs = append(refs, path.Clean(m[1]))
+	}
+	return refs
+}
+
+// Note returns the placemark text with any HTML markup stripped.
+func (p Placemark) Note() string {
+	desc := strings.TrimSpace(htmlTagPattern.ReplaceAllString(p.Description, ""))
+	switch {
+	case p.Name != "" && desc != "":
+		return p.Name + "\n" + desc
+	case desc != "":
+		return desc
+	default:
+		return p.Name
+	}
+}
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+func (raw rawPlacemark) flatten() ([]Placemark, error) {
+	var when time.Time
+	if raw.When != "" {
+		t, err := parseTime(raw.When)
+		if err != nil {
+			return nil, err
+		}
+		when = t
+	}
+
+	points := []rawPoint{}
+	lines := []rawLineString{}
+	tracks := []rawTrack{}
+	if raw.Point != nil {
+		points = append(points, *raw.Point)
+	}
+	if raw.LineString != nil {
+		lines = append(lines, *raw.LineString)
+	}
+	if raw.Track != nil {
+		tracks = append(tracks, *raw.Track)
+	}
+	if raw.Multi != nil {
+		points = append(points, raw.Multi.Points...)
+		lines = append(lines, raw.Multi.LineStrings...)
+		tracks = append(tracks, raw.Multi.Tracks...)
+	}
+
+	var out []Placemark
+	for _, p := range points {
+		coords, err := parseCoordinates(p.Coordinates)
+		if err != nil {
+			return nil, err
+		}
+		if len(coords) != 1 {
+			return nil, errors.New("<Point> must have exactly one coordinate")
+		}
+		out = append(out, Placemark{
+			Name:        raw.Name,
+			Description: raw.Description,
+			Points:      []Point{{Location: coords[0], Time: when}},
+		})
+	}
+
+	for _, l := range lines {
+		coords, err := parseCoordinates(l.Coordinates)
+		if err != nil {
+			return nil, err
+		}
+		pm := Placemark{Name: raw.Name, Description: raw.Description, IsPath: true}
+		for _, c := range coords {
+			pm.Points = append(pm.Points, Point{Location: c})
+		}
+		out = append(out, pm)
+	}
+
+	for _, t := range tracks {
+		if len(t.When) != 0 && len(t.When) != len(t.Coord) {
+			return nil, fmt.Errorf("gx:Track has %d <when> but %d <gx:coord>", len(t.When), len(t.Coord))
+		}
+		pm := Placemark{Name: raw.Name, Description: raw.Description, IsPath: true}
+		for i, c := range t.Coord {
+			loc, err := parsePosition(strings.Fields(c))
+			if err != nil {
+				return nil, err
+			}
+			p := Point{Location: loc}
+			if len(t.When) > 0 {
+				if p.Time, err = parseTime(t.When[i]); err != nil {
+					return nil, err
+				}
+			}
+			pm.Points = append(pm.Points, p)
+		}
+		out = append(out, pm)
+	}
+
+	return out, nil
+}
+
+// parseCoordinates reads a whitespace separated list of "lng,lat[,alt]" tuples.
+func parseCoordinates(v string) ([]orb.Point, error) {
+	var coords []orb.Point
+	for _, tuple := range strings.Fields(v) {
+		p, err := parsePosition(strings.Split(tuple, ","))
+		if err != nil {
+			return nil, err
+		}
+		coords = append(coords, p)
+	}
+	if len(coords) == 0 {
+		return nil, errors.New("empty <coordinates>")
+	}
+	return coords, nil
+}
+
+func parsePosition(parts []string) (orb.Point, error) {
+	if len(parts) < 2 {
+		return orb.Point{}, fmt.Errorf("invalid coordinate %q, expected lng,lat[,alt]", strings.Join(parts, ","))
+	}
+	lng, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return orb.Point{}, fmt.Errorf("invalid longitude %q", parts[0])
+	}
+	lat, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return orb.Point{}, fmt.Errorf("invalid latitude %q", parts[1])
+	}
+	if lat < -90 || lat > 90 {
+		return orb.Point{}, fmt.Errorf("latitude %v out of range", lat)
+	}
+	if lng < -180 || lng > 180 {
+		return orb.Point{}, fmt.Errorf("longitude %v out of range", lng)
+	}
+	return orb.Point{lng, lat}, nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(v))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected ISO 8601 (e.g. 2024-05-01T08:30:00Z)", v)
+	}
+	return t, nil
+}
+
+// --- Encoding ---
+
+type xmlKML struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document xmlDocument `xml:"Document"`
+}
+
+type xmlDocument struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	Placemarks  []xmlPlacemark `xml:"Placemark"`
+}
+
+type xmlPlacemark struct {
+	Name        string         `xml:"name,omitempty"`
+	Description string         `xml:"description,omitempty"`
+	TimeStamp   *xmlTimeStamp  `xml:"TimeStamp,omitempty"`
+	Point       *rawPoint      `xml:"Point,omitempty"`
+	LineString  *rawLineString `xml:"LineString,omitempty"`
+}
+
+type xmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+// Encode writes the document as KML 2.2. Path placemarks become a
+// LineString, all others a Point.
+func Encode(w io.Writer, doc *Document) error {
+	out := xmlKML{
+		Xmlns: Namespace,
+		Document: xmlDocument{
+			Name:        doc.Name,
+			Description: doc.Description,
+		},
+	}
+
+	for _, pm := range doc.Placemarks {
+		if len(pm.Points) == 0 {
+			continue
+		}
+
+		xpm := xmlPlacemark{Name: pm.Name, Description: pm.Description}
+		if pm.IsPath {
+			coords := make([]string, 0, len(pm.Points))
+			for _, p := range pm.Points {
+				coords = append(coords, formatPosition(p.Location))
+			}
+			xpm.LineString = &rawLineString{Coordinates: strings.Join(coords, " ")}
+		} else {
+			xpm.Point = &rawPoint{Coordinates: formatPosition(pm.Points[0].Location)}
+			if !pm.Points[0].Time.IsZero() {
+				xpm.TimeStamp = &xmlTimeStamp{When: pm.Points[0].Time.UTC().Format(time.RFC3339)}
+			}
+		}
+		out.Document.Placemarks = append(out.Document.Placemarks, xpm)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func formatPosition(p orb.Point) string {
+	return strconv.FormatFloat(p.Lon(), 'f', -1, 64) + "," + strconv.FormatFloat(p.Lat(), 'f', -1, 64)
+}
@@ -0,0 +1,274 @@
+package kml
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">
+  <Document>
+    <name>Lake District</name>
+    <description>Three days around the fells</description>
+    <Folder>
+      <name>Not the journey name</name>
+      <Placemark>
+        <name>Summit</name>
+        <description><![CDATA[Windy <b>top</b> <img src="files/summit.jpg"> <IMG SRC='./files/view.png'>]]></description>
+        <TimeStamp><when>2024-06-02T11:00:00Z</when></TimeStamp>
+        <Point><coordinates>-3.0112,54.4541,978</coordinates></Point>
+      </Placemark>
+    </Folder>
+    <Placemark>
+      <name>Route</name>
+      <LineString><coordinates>
+        -3.05,54.43,100 -3.03,54.44
+        -3.01,54.45
+      </coordinates></LineString>
+    </Placemark>
+    <Placemark>
+      <gx:Track>
+        <when>2024-06-02T09:00:00Z</when>
+        <when>2024-06-02T09:10:00Z</when>
+        <gx:coord>-3.05 54.43 100</gx:coord>
+        <gx:coord>-3.04 54.435 120</gx:coord>
+      </gx:Track>
+    </Placemark>
+    <Placemark>
+      <name>Huts</name>
+      <MultiGeometry>
+        <Point><coordinates>-3.1,54.4</coordinates></Point>
+        <Point><coordinates>-3.2,54.5</coordinates></Point>
+      </MultiGeometry>
+    </Placemark>
+  </Document>
+</kml>`
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if doc.Name != "Lake District" || doc.Description != "Three days around the fells" {
+		t.Errorf("Name, Description = %q, %q", doc.Name, doc.Description)
+	}
+	if len(doc.Placemarks) != 5 {
+		t.Fatalf("Placemarks = %d, want 5 (point, line, track, two from MultiGeometry)", len(doc.Placemarks))
+	}
+
+	summit := doc.Placemarks[0]
+	if summit.IsPath || len(summit.Points) != 1 {
+		t.Fatalf("summit = %+v, want a single point", summit)
+	}
+	if loc := summit.Points[0].Location; loc.Lon() != -3.0112 || loc.Lat() != 54.4541 {
+		t.Errorf("summit location = %v", loc)
+	}
+	if !summit.Points[0].Time.Equal(time.Date(2024, 6, 2, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("summit time = %v", summit.Points[0].Time)
+	}
+	if got := summit.Note(); got != "Summit\nWindy top" {
+		t.Errorf("Note = %q, want the markup stripped", got)
+	}
+	refs := summit.ImageRefs()
+	if len(refs) != 2 || refs[0] != "files/summit.jpg" || refs[1] != "files/view.png" {
+		t.Errorf("ImageRefs = %q", refs)
+	}
+
+	route := doc.Placemarks[1]
+	if !route.IsPath || len(route.Points) != 3 || !route.Points[0].Time.IsZero() {
+		t.Errorf("route = %+v, want a 3-point path without times", route)
+	}
+
+	track := doc.Placemarks[2]
+	if !track.IsPath || len(track.Points) != 2 {
+		t.Fatalf("track = %+v, want a 2-point path", track)
+	}
+	if !track.Points[1].Time.Equal(time.Date(2024, 6, 2, 9, 10, 0, 0, time.UTC)) {
+		t.Errorf("track time = %v", track.Points[1].Time)
+	}
+	if loc := track.Points[1].Location; loc.Lon() != -3.04 || loc.Lat() != 54.435 {
+		t.Errorf("track location = %v", loc)
+	}
+
+	for _, pm := range doc.Placemarks[3:] {
+		if pm.Name != "Huts" || pm.IsPath {
+			t.Errorf("MultiGeometry placemark = %+v", pm)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	wrap := func(placemark string) string {
+		return `<kml><Document><Placemark>` + placemark + `</Placemark></Document></kml>`
+	}
+
+	tests := []struct {
+		name string
+		kml  string
+		want string
+	}{
+		{"empty", ``, "file is empty"},
+		{"malformed xml", "<kml>\n<Document>\n</kml>", "malformed XML on line 3"},
+		{"wrong root", `<gpx version="1.1"/>`, "root element must be <kml>"},
+		{"no placemarks", `<kml><Document><name>Empty</name></Document></kml>`, "no placemarks"},
+		{"placemark without geometry", wrap(`<name>Nothing</name>`), "no placemarks"},
+		{"empty coordinates", wrap(`<Point><coordinates> </coordinates></Point>`), "empty <coordinates>"},
+		{"point with two coordinates", wrap(`<Point><coordinates>1,2 3,4</coordinates></Point>`), "exactly one coordinate"},
+		{"missing latitude", wrap(`<Point><coordinates>1</coordinates></Point>`), "expected lng,lat"},
+		{"bad longitude", wrap(`<Point><coordinates>east,2</coordinates></Point>`), `invalid longitude "east"`},
+		{"latitude out of range", wrap(`<Point><coordinates>0,90.5</coordinates></Point>`), "latitude 90.5 out of range"},
+		{"longitude out of range", wrap(`<LineString><coordinates>0,0 181,0</coordinates></LineString>`), "longitude 181 out of range"},
+		{"bad timestamp", wrap(`<TimeStamp><when>noon</when></TimeStamp><Point><coordinates>0,0</coordinates></Point>`), "invalid time"},
+		{"track with mismatched times", wrap(`<Track><when>2024-06-02T09:00:00Z</when><coord>0 0</coord><coord>1 1</coord></Track>`), "1 <when> but 2 <gx:coord>"},
+		{"error names its placemark", `<kml><Placemark><Point><coordinates>0,0</coordinates></Point></Placemark><Placemark><name>Broken</name><Point><coordinates>x</coordinates></Point></Placemark></kml>`, "placemark 2 (Broken)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.kml))
+			if err == nil {
+				t.Fatal("Parse succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	when := time.Date(2024, 6, 2, 11, 0, 0, 0, time.UTC)
+	doc := &Document{
+		Name: "Export",
+		Placemarks: []Placemark{
+			{Name: "Checkpoint 1", Description: "Lunch", Points: []Point{{Location: [2]float64{-3.01, 54.45}, Time: when}}},
+			{Name: "Route", IsPath: true, Points: []Point{{Location: [2]float64{-3.05, 54.43}}, {Location: [2]float64{-3.01, 54.45}}}},
+			{Name: "Dropped, no points"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, doc); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	parsed, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse of encoded KML: %v", err)
+	}
+
+	if parsed.Name != "Export" || len(parsed.Placemarks) != 2 {
+		t.Fatalf("round trip = %+v", parsed)
+	}
+	if p := parsed.Placemarks[0].Points[0]; !p.Time.Equal(when) || p.Location.Lon() != -3.01 {
+		t.Errorf("round trip point = %+v", p)
+	}
+	if !parsed.Placemarks[1].IsPath || len(parsed.Placemarks[1].Points) != 2 {
+		t.Errorf("round trip path = %+v", parsed.Placemarks[1])
+	}
+}
+
+func buildKMZ(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const photoKML = `<kml><Document><name>Photos</name>
+  <Placemark><description><![CDATA[<img src="files/a.jpg"><img src="files/missing.jpg">]]></description>
+    <Point><coordinates>1,2</coordinates></Point></Placemark>
+  <Placemark><description><![CDATA[<img src="files/path.jpg">]]></description>
+    <LineString><coordinates>1,2 3,4</coordinates></LineString></Placemark>
+</Document></kml>`
+
+func TestParseKMZ(t *testing.T) {
+	data := buildKMZ(t, map[string][]byte{
+		"other.kml":      []byte(`<kml><Placemark><Point><coordinates>0,0</coordinates></Point></Placemark></kml>`),
+		"doc.kml":        []byte(photoKML),
+		"files/a.jpg":    []byte("photo a"),
+		"files/path.jpg": []byte("only referenced by a path"),
+		"files/b.jpg":    []byte("not referenced"),
+	})
+
+	archive, err := ParseKMZ(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseKMZ: %v", err)
+	}
+	if archive.Document.Name != "Photos" {
+		t.Errorf("main document = %q, want doc.kml over other root .kml files", archive.Document.Name)
+	}
+	if len(archive.Files) != 1 || string(archive.Files["files/a.jpg"]) != "photo a" {
+		t.Errorf("Files = %v, want only the photo a point placemark references", keys(archive.Files))
+	}
+}
+
+func TestParseKMZFallsBackToRootKML(t *testing.T) {
+	data := buildKMZ(t, map[string][]byte{
+		"nested/doc.kml": []byte(`<kml><Document><name>Nested</name><Placemark><Point><coordinates>0,0</coordinates></Point></Placemark></Document></kml>`),
+		"trip.kml":       []byte(`<kml><Document><name>Root</name><Placemark><Point><coordinates>0,0</coordinates></Point></Placemark></Document></kml>`),
+	})
+
+	archive, err := ParseKMZ(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseKMZ: %v", err)
+	}
+	if archive.Document.Name != "Root" {
+		t.Errorf("main document = %q, want the .kml at the root", archive.Document.Name)
+	}
+}
+
+func TestParseKMZErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not a zip", []byte("PK but not really"), "not a valid KMZ"},
+		{"no kml", buildKMZ(t, map[string][]byte{"files/a.jpg": []byte("x")}), "contains no .kml document"},
+		{"invalid kml", buildKMZ(t, map[string][]byte{"doc.kml": []byte("<gpx/>")}), "doc.kml: root element must be <kml>"},
+		{
+			"oversized photo",
+			buildKMZ(t, map[string][]byte{"doc.kml": []byte(photoKML), "files/a.jpg": make([]byte, MaxEntryBytes+1)}),
+			"files/a.jpg in archive is too large",
+		},
+		{
+			"oversized document",
+			buildKMZ(t, map[string][]byte{"doc.kml": append([]byte("<kml>"), make([]byte, MaxDocumentBytes)...)}),
+			"doc.kml in archive is too large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKMZ(bytes.NewReader(tt.data))
+			if err == nil {
+				t.Fatal("ParseKMZ succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseKMZ error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func keys(files map[string][]byte) []string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/kml"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/upload"
+	"github.com/Mahaveer86619/TrailStory/pkg/utils"
+	"github.com/Mahaveer86619/TrailStory/pkg/views"
+
+	"gorm.io/gorm"
+)
+
+func (s *JourneyService) ImportKML(userID uint, file io.Reader, req views.ImportJourneyRequest) (*views.JourneyView, error) {
+	doc, err := kml.Parse(file)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid KML file: "+err.Error(), err)
+	}
+
+	imported, _ := fromKML(doc)
+	journey, err := s.saveImportedJourney(userID, req, imported, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetJourney(utils.MaskID(journey.ID), userID, views.JourneyOptions{})
+}
+
+// ImportKMZ imports the main KML document of the archive. Photos referenced
+// from a placemark description are attached to that placemark's checkpoint;
+// entries that are not acceptable media are skipped rather than failing the
+// import.
+func (s *JourneyService) ImportKMZ(userID uint, file io.Reader, req views.ImportJourneyRequest) (*views.JourneyView, error) {
+	archive, err := kml.ParseKMZ(file)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid KMZ file: "+err.Error(), err)
+	}
+
+	imported, refs := fromKML(archive.Document)
+
+	// Inspect every photo before the import starts, as UploadCheckpointMedia
+	// does, so nothing is stored for a journey that is then refused
+	var photos []archivePhoto
+	var total int64
+	used := map[string]bool{}
+	for _, w := range imported.Waypoints {
+		for _, ref := range refs[w] {
+			content, ok := archive.Files[ref]
+			if !ok || used[ref] {
+				continue
+			}
+			used[ref] = true
+
+			photo, err := upload.MediaPolicy.Inspect(bytes.NewReader(content))
+			if err == nil {
+				_, err = upload.MediaPolicy.Allow(photo.ContentType, int64(len(content)))
+			}
+			if err != nil {
+				continue
+			}
+			photos = append(photos, archivePhoto{point: w, name: path.Base(ref), file: photo})
+			total += int64(len(content))
+		}
+	}
+	if err := checkQuota(s.DB, userID, total); err != nil {
+		return nil, err
+	}
+
+	// Checkpoint IDs, which storage keys are built from, only exist inside the
+	// import's transaction; whatever is stored there is discarded on rollback
+	var stored []*models.Media
+	attach := func(tx *gorm.DB, journey *models.Journey) error {
+		for _, photo := range photos {
+			media, err := s.storeMedia(journey.ID, photo.point.CheckpointID, photo.name, photo.file)
+			if err != nil {
+				return err
+			}
+			stored = append(stored, media)
+		}
+		if len(stored) == 0 {
+			return nil
+		}
+		if err := reserveQuota(tx, userID, storedBytes(stored)); err != nil {
+			return err
+		}
+		if err := tx.Create(&stored).Error; err != nil {
+			return errz.New(errz.InternalServerError, "Failed to record media", err)
+		}
+		return nil
+	}
+
+	journey, err := s.saveImportedJourney(userID, req, imported, attach)
+	if err != nil {
+		go s.discardMedia(stored)
+		return nil, err
+	}
+
+	return s.GetJourney(utils.MaskID(journey.ID), userID, views.JourneyOptions{})
+}
+
+// archivePhoto is an inspected KMZ entry waiting for its checkpoint.
+type archivePhoto struct {
+	point *importedPoint
+	name  string
+	file  *upload.File
+}
+
+// ExportKML renders a journey as KML: a Point placemark per checkpoint and a
+// LineString placemark for the route.
+func (s *JourneyService) ExportKML(journeyMaskedID string, requesterID uint, w io.Writer) error {
+	journey, err := s.findVisibleJourney(journeyMaskedID, requesterID)
+	if err != nil {
+		return err
+	}
+
+	doc := &kml.Document{
+		Name:        journey.Title,
+		Description: journey.Description,
+	}
+
+	route := kml.Placemark{Name: journey.Title, IsPath: true}
+	for i, cp := range journey.Checkpoints {
+		point := kml.Point{Location: cp.Location.Point, Time: cp.Timestamp}
+		route.Points = append(route.Points, point)
+
+		doc.Placemarks = append(doc.Placemarks, kml.Placemark{
+			Name:        fmt.Sprintf("Checkpoint %d", i+1),
+			Description: cp.Note,
+			Points:      []kml.Point{point},
+		})
+	}
+
+	if len(route.Points) >= 2 {
+		doc.Placemarks = append(doc.Placemarks, route)
+	}
+
+	if err := kml.Encode(w, doc); err != nil {
+		return errz.New(errz.InternalServerError, "Failed to write KML", err)
+	}
+	return nil
+}
+
+// fromKML maps path placemarks to track points and point placemarks to
+// waypoints, returning the image references of each waypoint alongside.
+func fromKML(doc *kml.Document) (*importedJourney, map[*importedPoint][]string) {
+	imported := &importedJourney{
+		Title:       doc.Name,
+		Description: doc.Description,
+	}
+	refs := map[*importedPoint][]string{}
+
+	for _, pm := range doc.Placemarks {
+		if pm.IsPath {
+			for _, p := range pm.Points {
+				imported.Track = append(imported.Track, &importedPoint{Location: p.Location, Time: p.Time})
+			}
+			continue
+		}
+
+		w := &importedPoint{Location: pm.Points[0].Location, Time: pm.Points[0].Time, Note: pm.Note()}
+		imported.Waypoints = append(imported.Waypoints, w)
+		refs[w] = pm.ImageRefs()
+	}
+
+	return imported, refs
+}
@@ -0,0 +1,117 @@
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Event names sent on a journey stream.
+const (
+	EventCheckpoint = "checkpoint"
+	EventCompleted  = "completed"
+	EventHeartbeat  = "heartbeat"
+)
+
+// Each subscriber may fall this far behind before it is dropped. A dropped
+// client reconnects with Last-Event-ID and replays what it missed.
+const subscriberBuffer = 64
+
+type Event struct {
+	Seq  uint   // Deduplication key (the checkpoint ID), 0 for control events
+	ID   string // SSE id sent to the client, empty for control events
+	Name string
+	Data any
+}
+
+// Hub fans out journey events to in-process subscribers.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[uint]map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[uint]map[chan Event]struct{}{}}
+}
+
+// Subscribe registers a listener for a journey. The returned channel is
+// closed when cancel is called, when the subscriber falls too far behind, or
+// when the journey's subscriptions are closed.
+func (h *Hub) Subscribe(journeyID uint) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subs[journeyID] == nil {
+		h.subs[journeyID] = map[chan Event]struct{}{}
+	}
+	h.subs[journeyID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(journeyID, ch)
+	}
+	return ch, cancel
+}
+
+// Publish delivers ev to every subscriber of the journey without blocking.
+func (h *Hub) Publish(journeyID uint, ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[journeyID] {
+		select {
+		case ch <- ev:
+		default:
+			h.remove(journeyID, ch)
+		}
+	}
+}
+
+// Close ends every subscription to a journey.
+func (h *Hub) Close(journeyID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[journeyID] {
+		h.remove(journeyID, ch)
+	}
+}
+
+// remove must be called with h.mu held.
+func (h *Hub) remove(journeyID uint, ch chan Event) {
+	if _, ok := h.subs[journeyID][ch]; !ok {
+		return
+	}
+	delete(h.subs[journeyID], ch)
+	close(ch)
+	if len(h.subs[journeyID]) == 0 {
+		delete(h.subs, journeyID)
+	}
+}
+
+// Subscription is a live stream primed with the events the client missed.
+type Subscription struct {
+	Replay    []Event
+	Events    <-chan Event
+	Cancel    func()
+	Completed bool // The journey has ended; send the replay and stop
+}
+
+// WriteEvent encodes ev in the text/event-stream format.
+func WriteEvent(w io.Writer, ev Event) error {
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return err
+	}
+
+	if ev.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", ev.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Name, data)
+	return err
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"time"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/live"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+	"github.com/Mahaveer86619/TrailStory/pkg/utils"
+	"github.com/Mahaveer86619/TrailStory/pkg/views"
+)
+
+// Checkpoints are stamped when inserted but become visible when their
+// transaction commits, so a replay reaches back this far before the last
+// event a client saw.
+const liveReplayOverlap = time.Minute
+
+// SubscribeLive opens a live stream for a journey, under the same privacy
+// rules as GetJourney. With a Last-Event-ID, checkpoints created since that
+// event are replayed first. The replay overlaps what the client already has,
+// so clients drop events whose ID they have seen.
+func (s *JourneyService) SubscribeLive(journeyMaskedID string, requesterID uint, lastEventID string) (*live.Subscription, error) {
+	journeyID, err := utils.UnmaskID(journeyMaskedID)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid Journey ID", err)
+	}
+
+	var afterID uint
+	if lastEventID != "" {
+		if afterID, err = utils.UnmaskID(lastEventID); err != nil {
+			return nil, errz.New(errz.BadRequest, "Invalid Last-Event-ID", err)
+		}
+	}
+
+	// Subscribe before checking access and reading the replay: a journey
+	// made private or deleted from here on closes the subscription, and
+	// nothing committed in between is lost
+	events, cancel := s.Live.Subscribe(journeyID)
+	sub, err := s.openLive(journeyID, requesterID, afterID, lastEventID != "")
+	if err != nil || sub.Completed {
+		cancel()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !sub.Completed {
+		sub.Events, sub.Cancel = events, cancel
+	}
+	return sub, nil
+}
+
+func (s *JourneyService) openLive(journeyID, requesterID, afterID uint, resume bool) (*live.Subscription, error) {
+	var journey models.Journey
+	if err := s.DB.First(&journey, journeyID).Error; err != nil {
+		return nil, errz.New(errz.NotFound, "Journey not found", err)
+	}
+	if journey.UserID != requesterID && !journey.IsPublic {
+		return nil, errz.New(errz.Forbidden, "This journey is private", nil)
+	}
+
+	sub := &live.Subscription{Completed: journey.EndedAt != nil}
+	if !resume {
+		return sub, nil
+	}
+
+	// An unknown last event replays the whole journey
+	var since time.Time
+	var last models.Checkpoint
+	if err := s.DB.Unscoped().Select("id, created_at").First(&last, afterID).Error; err == nil {
+		since = last.CreatedAt.Add(-liveReplayOverlap)
+	}
+
+	var missed []models.Checkpoint
+	err := s.DB.Select("*, ST_AsText(location) as location").
+		Where("journey_id = ? AND created_at >= ?", journeyID, since).
+		Order("created_at asc, id asc").
+		Preload("Media").
+		Find(&missed).Error
+	if err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to replay checkpoints", err)
+	}
+
+	store := views.MediaStorage(journey.IsPublic, s.Storage)
+	for i := range missed {
+		sub.Replay = append(sub.Replay, s.checkpointEvent(&missed[i], store))
+	}
+	return sub, nil
+}
+
+func (s *JourneyService) publishCheckpoint(cp *models.Checkpoint) {
+	s.Live.Publish(cp.JourneyID, s.checkpointEvent(cp, s.checkpointStorage(cp.JourneyID)))
+}
+
+func (s *JourneyService) publishCompleted(journeyID uint) {
+	s.Live.Publish(journeyID, live.Event{
+		Name: live.EventCompleted,
+		Data: map[string]string{"journey_id": utils.MaskID(journeyID)},
+	})
+}
+
+// closeLive ends the live streams of a journey that subscribers may no
+// longer see. Clients reconnect and have their access checked again.
+func (s *JourneyService) closeLive(journeyID uint) {
+	s.Live.Close(journeyID)
+}
+
+func (s *JourneyService) checkpointEvent(cp *models.Checkpoint, store storage.StorageService) live.Event {
+	return live.Event{
+		Seq:  cp.ID,
+		ID:   utils.MaskID(cp.ID),
+		Name: live.EventCheckpoint,
+		Data: views.ToCheckpointView(cp, store),
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/upload"
+	"github.com/Mahaveer86619/TrailStory/pkg/utils"
+	"github.com/Mahaveer86619/TrailStory/pkg/views"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"gorm.io/gorm"
+)
+
+// Direct upload URLs stay valid this long.
+const uploadURLExpiry = 15 * time.Minute
+
+// Direct uploads are stored as upload_<random><ext> in the checkpoint folder.
+const directUploadPrefix = "upload_"
+
+// Advisory locks on upload keys use this as their first key.
+const uploadLockSpace = 1
+
+// CreateMediaUpload issues a URL to send one file straight to storage, so
+// large videos do not pass through the API. The key is chosen here; the
+// client only declares the type and exact size, which the URL is bound to.
+func (s *JourneyService) CreateMediaUpload(userID uint, checkpointMaskedID string, req views.MediaUploadRequest) (*views.MediaUploadView, error) {
+	checkpointID, err := utils.UnmaskID(checkpointMaskedID)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid Checkpoint ID", err)
+	}
+
+	cp, err := s.findOwnedCheckpoint(userID, checkpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := upload.MediaPolicy.Allow(req.ContentType, req.SizeBytes); err != nil {
+		return nil, uploadError(req.ContentType, err)
+	}
+	if err := checkQuota(s.DB, userID, req.SizeBytes); err != nil {
+		return nil, err
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to create upload", err)
+	}
+	filename := directUploadPrefix + hex.EncodeToString(random) + upload.Ext(req.ContentType)
+	key := storage.MediaKey(fmt.Sprint(cp.JourneyID), fmt.Sprint(cp.ID), filename)
+
+	target, err := s.Storage.PresignUpload(key, req.ContentType, req.SizeBytes, uploadURLExpiry)
+	if err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to create upload", err)
+	}
+
+	return &views.MediaUploadView{
+		Key:       key,
+		URL:       target.URL,
+		Method:    target.Method,
+		Headers:   target.Headers,
+		ExpiresAt: target.ExpiresAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// CompleteMediaUpload records a file sent through CreateMediaUpload. The
+// stored object is checked like any other upload: its type is sniffed from
+// its bytes and its size held to the policy.
+func (s *JourneyService) CompleteMediaUpload(userID uint, checkpointMaskedID string, req views.CompleteMediaUploadRequest) (*views.CheckpointView, error) {
+	checkpointID, err := utils.UnmaskID(checkpointMaskedID)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid Checkpoint ID", err)
+	}
+
+	cp, err := s.findOwnedCheckpoint(userID, checkpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := storage.MediaKey(fmt.Sprint(cp.JourneyID), fmt.Sprint(cp.ID), directUploadPrefix)
+	if !strings.HasPrefix(req.Key, prefix) || strings.ContainsAny(req.Key[len(prefix):], `/\`) {
+		return nil, errz.New(errz.BadRequest, "Upload key was not issued for this checkpoint", nil)
+	}
+
+	// Completing the same key twice at once must neither record it twice
+	// nor delete what the other call records
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?::integer, hashtext(?))", uploadLockSpace, req.Key).Error; err != nil {
+			return errz.New(errz.InternalServerError, "Failed to complete upload", err)
+		}
+
+		var existing int64
+		if err := tx.Model(&models.Media{}).Unscoped().Where("url = ?", req.Key).Count(&existing).Error; err != nil {
+			return errz.New(errz.InternalServerError, "Failed to complete upload", err)
+		}
+		if existing > 0 {
+			return errz.New(errz.Conflict, "Upload already completed", nil)
+		}
+
+		info, err := s.Storage.Stat(req.Key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return errz.New(errz.BadRequest, "Upload not found; send the file before completing", err)
+		}
+		if err != nil {
+			return errz.New(errz.InternalServerError, "Failed to complete upload", err)
+		}
+
+		// The declared size was checked when the URL was issued, but other
+		// uploads may have landed since
+		err = reserveQuota(tx, userID, info.Size)
+		var media *models.Media
+		if err == nil {
+			media, err = s.inspectStoredMedia(cp, req.Key, info)
+		}
+		if err != nil {
+			// A rejected upload is nobody's; don't wait for the garbage
+			// collector. After a failure on our side the client may complete
+			// it again.
+			var rejected *errz.BooktureError
+			if errors.As(err, &rejected) && rejected.Type != errz.InternalServerError {
+				deleteStored(s.Storage, []string{req.Key})
+			}
+			return err
+		}
+
+		if err := tx.Create(media).Error; err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+				return errz.New(errz.Conflict, "Upload already completed", err)
+			}
+			return errz.New(errz.InternalServerError, "Failed to record media", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getCheckpointView(cp.ID)
+}
+
+// inspectStoredMedia validates a directly uploaded object and builds its
+// Media row, rendering variants for images.
+func (s *JourneyService) inspectStoredMedia(cp *models.Checkpoint, key string, info *storage.ObjectInfo) (*models.Media, error) {
+	filename := path.Base(key)
+
+	stored, err := s.Storage.Open(key)
+	if err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to read upload", err)
+	}
+	defer stored.Close()
+
+	file, err := upload.MediaPolicy.Inspect(stored)
+	if err != nil {
+		return nil, uploadError(filename, err)
+	}
+	if _, err := upload.MediaPolicy.Allow(file.ContentType, info.Size); err != nil {
+		return nil, uploadError(filename, err)
+	}
+
+	media := &models.Media{
+		CheckpointID: cp.ID,
+		URL:          key,
+		Type:         file.Kind,
+		ContentType:  file.ContentType,
+		SizeBytes:    info.Size,
+	}
+	if file.Kind == upload.KindImage {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, uploadError(filename, err)
+		}
+		if media.Variants, err = s.saveMediaVariants(cp.JourneyID, cp.ID, filename, data); err != nil {
+			return nil, errz.New(errz.InternalServerError, "Failed to save media", err)
+		}
+	}
+	return media, nil
+}
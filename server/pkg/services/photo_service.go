@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"time"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/exif"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/geocoder"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/upload"
+	"github.com/Mahaveer86619/TrailStory/pkg/utils"
+	"github.com/Mahaveer86619/TrailStory/pkg/views"
+
+	"gorm.io/gorm"
+)
+
+// ImportPhotos creates a checkpoint at the GPS location and capture time of
+// each photo, with the photo attached. Photos without a location are reported
+// back rather than dropped, and so is any photo that fails: the earlier ones
+// are already imported, so the client needs every result to retry safely.
+// Photos count towards the quota at their uploaded size, like any upload.
+func (s *JourneyService) ImportPhotos(userID uint, journeyMaskedID string, files []*multipart.FileHeader) (*views.PhotoImportView, error) {
+	journeyID, err := utils.UnmaskID(journeyMaskedID)
+	if err != nil {
+		return nil, errz.New(errz.BadRequest, "Invalid Journey ID", err)
+	}
+
+	if len(files) == 0 {
+		return nil, errz.New(errz.BadRequest, "At least one photo is required", nil)
+	}
+
+	if _, err := s.findOwnedJourney(userID, journeyID); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, header := range files {
+		total += header.Size
+	}
+	if err := checkQuota(s.DB, userID, total); err != nil {
+		return nil, err
+	}
+
+	resp := &views.PhotoImportView{Results: make([]views.PhotoImportResult, 0, len(files))}
+	for _, header := range files {
+		result, err := s.importPhoto(userID, journeyID, header)
+		if err != nil {
+			result.Status, result.Error = photoImportFailure(err)
+		}
+
+		switch result.Status {
+		case views.PhotoStatusCreated:
+			resp.Created++
+		case views.PhotoStatusNoGPS:
+			resp.NoGPS++
+		case views.PhotoStatusInvalid:
+			resp.Invalid++
+		case views.PhotoStatusError:
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	return resp, nil
+}
+
+// photoImportFailure turns an error importing one photo into its result:
+// invalid when the photo was refused, error when we failed.
+func photoImportFailure(err error) (string, string) {
+	var bkErr *errz.BooktureError
+	if errors.As(err, &bkErr) {
+		if bkErr.Type != errz.InternalServerError {
+			return views.PhotoStatusInvalid, bkErr.Message
+		}
+		err = bkErr.Err
+	}
+
+	log.Printf("Photo import failed: %v", err)
+	return views.PhotoStatusError, "Failed to import photo, please retry"
+}
+
+// importPhoto returns an error only for failures on our side; problems with
+// the photo itself are reported in the result.
+func (s *JourneyService) importPhoto(userID, journeyID uint, header *multipart.FileHeader) (views.PhotoImportResult, error) {
+	result := views.PhotoImportResult{Filename: header.Filename}
+
+	file, err := upload.PhotoPolicy.Open(header)
+	if err != nil {
+		if errors.Is(err, upload.ErrTooLarge) || errors.Is(err, upload.ErrUnsupportedType) {
+			result.Status, result.Error = views.PhotoStatusInvalid, err.Error()
+			return result, nil
+		}
+		return result, errz.New(errz.BadRequest, "Failed to read uploaded file", err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		if errors.Is(err, upload.ErrTooLarge) {
+			result.Status, result.Error = views.PhotoStatusInvalid, err.Error()
+			return result, nil
+		}
+		return result, errz.New(errz.BadRequest, "Failed to read uploaded file", err)
+	}
+
+	info, err := exif.Decode(bytes.NewReader(data))
+	switch {
+	case errors.Is(err, exif.ErrNoExif):
+		result.Status, result.Error = views.PhotoStatusNoGPS, "Photo has no EXIF data"
+		return result, nil
+	case err != nil:
+		result.Status, result.Error = views.PhotoStatusInvalid, "Unreadable photo: "+err.Error()
+		return result, nil
+	case info.Location == nil:
+		result.Status, result.Error = views.PhotoStatusNoGPS, "Photo has no GPS location"
+		return result, nil
+	}
+
+	location := *info.Location
+	ts := info.Time
+	switch {
+	case ts.IsZero():
+		ts = time.Now()
+	case !info.HasZone:
+		// A bare camera clock reads local time where the photo was taken
+		loc := geocoder.LocationAt(location.Lat(), location.Lon())
+		ts = time.Date(ts.Year(), ts.Month(), ts.Day(), ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), loc)
+	}
+
+	cp := models.Checkpoint{
+		JourneyID: journeyID,
+		Location:  models.GeoPoint{Point: location},
+		Timestamp: ts,
+	}
+
+	photo, err := upload.PhotoPolicy.Inspect(bytes.NewReader(data))
+	if err != nil {
+		return result, uploadError(header.Filename, err)
+	}
+
+	// The checkpoint ID is part of the storage key, so the photo is stored
+	// inside the transaction and discarded if it rolls back
+	var media *models.Media
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&cp).Error; err != nil {
+			return err
+		}
+
+		if media, err = s.storeMedia(journeyID, cp.ID, header.Filename, photo); err != nil {
+			return err
+		}
+		if err := reserveQuota(tx, userID, media.SizeBytes); err != nil {
+			return err
+		}
+		if err := tx.Create(media).Error; err != nil {
+			return err
+		}
+		cp.Media = []models.Media{*media}
+		return nil
+	})
+	if err != nil {
+		if media != nil {
+			go s.discardMedia([]*models.Media{media})
+		}
+
+		var bkErr *errz.BooktureError
+		if errors.As(err, &bkErr) {
+			return result, err
+		}
+		return result, errz.New(errz.InternalServerError, "Failed to import photo", err)
+	}
+	s.publishCheckpoint(&cp)
+	s.resolvePlacesAsync([]models.Checkpoint{cp})
+
+	result.Status = views.PhotoStatusCreated
+	result.ID = utils.MaskID(cp.ID)
+	return result, nil
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/config"
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/views"
+
+	"gorm.io/gorm"
+)
+
+// quotaBytes is the configured per-user limit, 0 when there is none.
+func quotaBytes() int64 {
+	mb, err := strconv.ParseInt(config.AppConfig.STORAGE_QUOTA_MB, 10, 64)
+	if err != nil || mb <= 0 {
+		return 0
+	}
+	return mb << 20
+}
+
+// storageUsed totals the uploads of a user's live journeys and their avatar.
+// Generated variants are not counted, and a file uploaded twice counts twice
+// even when deduplicated.
+func storageUsed(database *gorm.DB, userID uint) (int64, error) {
+	var media int64
+	err := database.Model(&models.Media{}).
+		Select("COALESCE(SUM(media.size_bytes), 0)").
+		Joins("JOIN checkpoints ON checkpoints.id = media.checkpoint_id AND checkpoints.deleted_at IS NULL").
+		Joins("JOIN journeys ON journeys.id = checkpoints.journey_id AND journeys.deleted_at IS NULL").
+		Where("journeys.user_id = ?", userID).
+		Scan(&media).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var avatar int64
+	err = database.Model(&models.User{}).
+		Select("profile_pic_size").
+		Where("id = ?", userID).
+		Scan(&avatar).Error
+	return media + avatar, err
+}
+
+// Advisory locks on a user's quota use this as their first key.
+const quotaLockSpace = 2
+
+// checkQuota fails when adding more bytes would take the user over their
+// quota. On its own it only rejects early, before anything is stored:
+// concurrent uploads can all pass it. reserveQuota is the binding check.
+func checkQuota(database *gorm.DB, userID uint, adding int64) error {
+	limit := quotaBytes()
+	if limit == 0 || adding <= 0 {
+		return nil
+	}
+
+	used, err := storageUsed(database, userID)
+	if err != nil {
+		return errz.New(errz.InternalServerError, "Failed to check storage quota", err)
+	}
+	if used+adding > limit {
+		return errz.New(errz.QuotaExceeded, fmt.Sprintf(
+			"Storage quota exceeded: %d MB used of %d MB, this upload needs %d MB more",
+			used>>20, limit>>20, (adding+(1<<20)-1)>>20,
+		), nil)
+	}
+	return nil
+}
+
+// reserveQuota is checkQuota inside the transaction that records the bytes.
+// It holds a lock on the user's quota until tx ends, so concurrent uploads
+// are counted one after the other and cannot go over together.
+func reserveQuota(tx *gorm.DB, userID uint, adding int64) error {
+	if quotaBytes() == 0 || adding <= 0 {
+		return nil
+	}
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?::integer, ?::integer)", quotaLockSpace, userID).Error; err != nil {
+		return errz.New(errz.InternalServerError, "Failed to check storage quota", err)
+	}
+	return checkQuota(tx, userID, adding)
+}
+
+// storedBytes totals what the quota counts of media rows.
+func storedBytes(media []*models.Media) int64 {
+	var total int64
+	for _, m := range media {
+		total += m.SizeBytes
+	}
+	return total
+}
+
+func (s *UserService) storageUsage(userID uint) (*views.StorageUsageView, error) {
+	used, err := storageUsed(s.DB, userID)
+	if err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to compute storage usage", err)
+	}
+	return views.ToStorageUsageView(used, quotaBytes()), nil
+}
+
+// BackfillMediaSizes records the size of live media uploaded before sizes
+// were counted, from the stored originals. Rows that fail are logged and
+// skipped. Returns how many were filled.
+func (s *JourneyService) BackfillMediaSizes() (int, error) {
+	filled := 0
+	var lastID uint
+
+	for {
+		var page []models.Media
+		err := s.DB.Select("media.id, media.url").
+			Joins("JOIN checkpoints ON checkpoints.id = media.checkpoint_id AND checkpoints.deleted_at IS NULL").
+			Joins("JOIN journeys ON journeys.id = checkpoints.journey_id AND journeys.deleted_at IS NULL").
+			Where("media.size_bytes = 0 AND media.id > ?", lastID).
+			Order("media.id asc").Limit(backfillPageSize).Find(&page).Error
+		if err != nil {
+			return filled, err
+		}
+		if len(page) == 0 {
+			return filled, nil
+		}
+		lastID = page[len(page)-1].ID
+
+		for _, m := range page {
+			info, err := s.Storage.Stat(m.URL)
+			if err != nil {
+				log.Printf("Backfill media %d: stat %s: %v", m.ID, m.URL, err)
+				continue
+			}
+			if err := s.DB.Model(&models.Media{}).Where("id = ?", m.ID).Update("size_bytes", info.Size).Error; err != nil {
+				return filled, err
+			}
+			filled++
+		}
+	}
+}
+
+// BackfillAvatarSizes is BackfillMediaSizes for profile pictures.
+func (s *UserService) BackfillAvatarSizes() (int, error) {
+	filled := 0
+	var lastID uint
+
+	for {
+		var page []models.User
+		err := s.DB.Select("id, profile_pic").
+			Where("profile_pic <> '' AND profile_pic_size = 0 AND id > ?", lastID).
+			Order("id asc").Limit(backfillPageSize).Find(&page).Error
+		if err != nil {
+			return filled, err
+		}
+		if len(page) == 0 {
+			return filled, nil
+		}
+		lastID = page[len(page)-1].ID
+
+		for _, u := range page {
+			info, err := s.Storage.Stat(u.ProfilePic)
+			if err != nil {
+				log.Printf("Backfill user %d: stat %s: %v", u.ID, u.ProfilePic, err)
+				continue
+			}
+			if err := s.DB.Model(&models.User{}).Where("id = ?", u.ID).Update("profile_pic_size", info.Size).Error; err != nil {
+				return filled, err
+			}
+			filled++
+		}
+	}
+}
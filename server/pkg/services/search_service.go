@@ -0,0 +1,168 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/views"
+)
+
+// nearbyJourneysQuery finds visible journeys with at least one checkpoint
+// within the radius, nearest first. ST_DWithin on geography is served by
+// idx_checkpoints_location_geog.
+const nearbyJourneysQuery = `
+SELECT
+	journeys.id AS journey_id,
+	MIN(ST_Distance(checkpoints.location::geography, ST_SetSRID(ST_MakePoint(@lng, @lat), 4326)::geography)) AS distance_m
+FROM checkpoints
+JOIN journeys ON journeys.id = checkpoints.journey_id
+WHERE checkpoints.deleted_at IS NULL
+	AND journeys.deleted_at IS NULL
+	AND (journeys.is_public OR journeys.user_id = @requester)
+	AND ST_DWithin(checkpoints.location::geography, ST_SetSRID(ST_MakePoint(@lng, @lat), 4326)::geography, @radius)
+GROUP BY journeys.id
+ORDER BY distance_m ASC, journeys.id ASC
+LIMIT @limit
+`
+
+type nearbyJourneyRow struct {
+	JourneyID uint
+	DistanceM float64
+}
+
+func (s *JourneyService) FindNearbyJourneys(requesterID uint, req views.NearbyRequest) ([]views.NearbyJourneyView, error) {
+	var rows []nearbyJourneyRow
+	err := s.DB.Raw(nearbyJourneysQuery, map[string]interface{}{
+		"lat":       req.Lat,
+		"lng":       req.Lng,
+		"radius":    req.RadiusM,
+		"requester": requesterID,
+		"limit":     req.Limit,
+	}).Scan(&rows).Error
+	if err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to search nearby journeys", err)
+	}
+
+	ids := make([]uint, 0, len(rows))
+	distances := make(map[uint]float64, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.JourneyID)
+		distances[row.JourneyID] = row.DistanceM
+	}
+
+	journeys, err := s.findJourneysByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.toJourneySummaries(journeys)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]views.NearbyJourneyView, 0, len(list))
+	for i, j := range journeys {
+		resp = append(resp, views.NearbyJourneyView{JourneyView: list[i], DistanceM: distances[j.ID]})
+	}
+	return resp, nil
+}
+
+// FindInViewport returns visible checkpoints inside the bounding box, plus
+// the journeys they belong to (without their full checkpoint lists).
+func (s *JourneyService) FindInViewport(requesterID uint, req views.ViewportRequest) (*views.ViewportView, error) {
+	query := s.DB.Model(&models.Checkpoint{}).
+		Select("checkpoints.*, ST_AsText(checkpoints.location) as location").
+		Joins("JOIN journeys ON journeys.id = checkpoints.journey_id").
+		Where("journeys.deleted_at IS NULL").
+		Where("(journeys.is_public OR journeys.user_id = ?)", requesterID)
+
+	// A box crossing the antimeridian is searched as two
+	var within []string
+	var args []interface{}
+	for _, box := range req.Boxes() {
+		within = append(within, "checkpoints.location && ST_MakeEnvelope(?, ?, ?, ?, 4326)")
+		args = append(args, box.Min.Lon(), box.Min.Lat(), box.Max.Lon(), box.Max.Lat())
+	}
+	query = query.Where("("+strings.Join(within, " OR ")+")", args...)
+
+	if req.From != nil {
+		query = query.Where("checkpoints.timestamp >= ?", *req.From)
+	}
+	if req.To != nil {
+		query = query.Where("checkpoints.timestamp <= ?", *req.To)
+	}
+
+	// Fetch one extra row to know whether the result was capped
+	var checkpoints []models.Checkpoint
+	err := query.Order("checkpoints.timestamp asc, checkpoints.id asc").
+		Limit(req.Limit + 1).
+		Preload("Media").
+		Find(&checkpoints).Error
+	if err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to search viewport", err)
+	}
+
+	truncated := len(checkpoints) > req.Limit
+	if truncated {
+		checkpoints = checkpoints[:req.Limit]
+	}
+
+	var ids []uint
+	seen := map[uint]bool{}
+	for _, cp := range checkpoints {
+		if !seen[cp.JourneyID] {
+			seen[cp.JourneyID] = true
+			ids = append(ids, cp.JourneyID)
+		}
+	}
+
+	var journeys []models.Journey
+	if len(ids) > 0 {
+		if err := s.DB.Where("id IN ?", ids).Order("created_at desc").Find(&journeys).Error; err != nil {
+			return nil, errz.New(errz.InternalServerError, "Failed to fetch journeys", err)
+		}
+	}
+
+	list, err := s.toJourneySummaries(journeys)
+	if err != nil {
+		return nil, err
+	}
+
+	public := make(map[uint]bool, len(journeys))
+	for _, j := range journeys {
+		public[j.ID] = j.IsPublic
+	}
+
+	view := views.ToViewportView(checkpoints, list, public, s.Storage)
+	view.Truncated = truncated
+	view.Limit = req.Limit
+	return &view, nil
+}
+
+// findJourneysByIDs loads journeys, without their checkpoints, returned in
+// the same order as ids.
+func (s *JourneyService) findJourneysByIDs(ids []uint) ([]models.Journey, error) {
+	if len(ids) == 0 {
+		return []models.Journey{}, nil
+	}
+
+	var found []models.Journey
+	err := s.DB.Where("id IN ?", ids).Find(&found).Error
+	if err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to fetch journeys", err)
+	}
+
+	byID := make(map[uint]models.Journey, len(found))
+	for _, j := range found {
+		byID[j.ID] = j
+	}
+
+	journeys := make([]models.Journey, 0, len(ids))
+	for _, id := range ids {
+		if j, ok := byID[id]; ok {
+			journeys = append(journeys, j)
+		}
+	}
+	return journeys, nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"math"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/views"
+)
+
+// Meters per degree of latitude, close enough for simplification tolerances.
+const metersPerDegree = 111320.0
+
+// simplifyJourney drops checkpoints that do not change the shape of the path
+// by more than toleranceM meters (Douglas-Peucker). Only the in-memory copy is
+// changed; the database keeps every point. Returns nil when nothing was asked.
+func simplifyJourney(j *models.Journey, toleranceM float64) *views.SimplificationView {
+	if toleranceM <= 0 {
+		return nil
+	}
+
+	original := len(j.Checkpoints)
+	j.Checkpoints = simplifyCheckpoints(j.Checkpoints, toleranceM)
+
+	return &views.SimplificationView{
+		ToleranceM:     toleranceM,
+		OriginalPoints: original,
+		DroppedPoints:  original - len(j.Checkpoints),
+	}
+}
+
+// simplifyCheckpoints runs Douglas-Peucker in a local equirectangular
+// projection so the tolerance is in meters. Checkpoints carrying a note or
+// media are always kept, as are the first and last.
+func simplifyCheckpoints(cps []models.Checkpoint, toleranceM float64) []models.Checkpoint {
+	if len(cps) < 3 {
+		return cps
+	}
+
+	meanLat := 0.0
+	for _, cp := range cps {
+		meanLat += cp.Location.Point.Lat()
+	}
+	meanLat /= float64(len(cps))
+	lngScale := math.Cos(meanLat*math.Pi/180) * metersPerDegree
+
+	xs := make([]float64, len(cps))
+	ys := make([]float64, len(cps))
+	keep := make([]bool, len(cps))
+	for i, cp := range cps {
+		xs[i] = cp.Location.Point.Lon() * lngScale
+		ys[i] = cp.Location.Point.Lat() * metersPerDegree
+		keep[i] = cp.Note != "" || len(cp.Media) > 0
+	}
+	keep[0] = true
+	keep[len(cps)-1] = true
+
+	// Iterative to avoid deep recursion on long tracks
+	stack := [][2]int{{0, len(cps) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		start, end := span[0], span[1]
+
+		maxDist, maxIndex := 0.0, -1
+		for i := start + 1; i < end; i++ {
+			if d := segmentDistance(xs[i], ys[i], xs[start], ys[start], xs[end], ys[end]); d > maxDist {
+				maxDist, maxIndex = d, i
+			}
+		}
+
+		if maxIndex >= 0 && maxDist > toleranceM {
+			keep[maxIndex] = true
+			stack = append(stack, [2]int{start, maxIndex}, [2]int{maxIndex, end})
+		}
+	}
+
+	kept := make([]models.Checkpoint, 0, len(cps))
+	for i, cp := range cps {
+		if keep[i] {
+			kept = append(kept, cp)
+		}
+	}
+	return kept
+}
+
+// segmentDistance is the distance from (px, py) to the segment (ax, ay)-(bx, by).
+func segmentDistance(px, py, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	if dx == 0 && dy == 0 {
+		return math.Hypot(px-ax, py-ay)
+	}
+
+	t := ((px-ax)*dx + (py-ay)*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+
+	"github.com/paulmach/orb"
+	"gorm.io/gorm"
+)
+
+// track builds checkpoints on the equator, where a degree is metersPerDegree
+// in both directions. Each point is {lng, lat} in meters from the origin.
+func track(points ...[2]float64) []models.Checkpoint {
+	cps := make([]models.Checkpoint, len(points))
+	for i, p := range points {
+		cps[i] = models.Checkpoint{
+			Model:    gorm.Model{ID: uint(i + 1)},
+			Location: models.GeoPoint{Point: orb.Point{p[0] / metersPerDegree, p[1] / metersPerDegree}},
+		}
+	}
+	return cps
+}
+
+func TestSimplifyCheckpoints(t *testing.T) {
+	withNote := func(cps []models.Checkpoint, i int) []models.Checkpoint {
+		cps[i].Note = "Lunch"
+		return cps
+	}
+	withMedia := func(cps []models.Checkpoint, i int) []models.Checkpoint {
+		cps[i].Media = []models.Media{{URL: "journeys/1/photo.jpg"}}
+		return cps
+	}
+
+	tests := []struct {
+		name      string
+		cps       []models.Checkpoint
+		tolerance float64
+		want      []uint // IDs of the kept checkpoints
+	}{
+		{"empty", nil, 10, nil},
+		{"two points", track([2]float64{0, 0}, [2]float64{100, 0}), 10, []uint{1, 2}},
+		{
+			"straight line keeps the ends",
+			track([2]float64{0, 0}, [2]float64{100, 1}, [2]float64{200, -1}, [2]float64{300, 0}),
+			10, []uint{1, 4},
+		},
+		{
+			"deviation over the tolerance is kept",
+			track([2]float64{0, 0}, [2]float64{100, 50}, [2]float64{200, 0}),
+			10, []uint{1, 2, 3},
+		},
+		{
+			"deviation within the tolerance is dropped",
+			track([2]float64{0, 0}, [2]float64{100, 50}, [2]float64{200, 0}),
+			60, []uint{1, 3},
+		},
+		{
+			"recurses into both halves",
+			track([2]float64{0, 0}, [2]float64{50, 20}, [2]float64{100, 100}, [2]float64{150, 50}, [2]float64{200, 0}),
+			10, []uint{1, 2, 3, 5},
+		},
+		{
+			"point with a note is kept",
+			withNote(track([2]float64{0, 0}, [2]float64{100, 0}, [2]float64{200, 0}), 1),
+			10, []uint{1, 2, 3},
+		},
+		{
+			"point with media is kept",
+			withMedia(track([2]float64{0, 0}, [2]float64{100, 0}, [2]float64{200, 0}, [2]float64{300, 0}), 2),
+			10, []uint{1, 3, 4},
+		},
+		{
+			"loop back to the start",
+			track([2]float64{0, 0}, [2]float64{100, 0}, [2]float64{100, 100}, [2]float64{0, 0}),
+			10, []uint{1, 2, 3, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := simplifyCheckpoints(tt.cps, tt.tolerance)
+			var ids []uint
+			for _, cp := range got {
+				ids = append(ids, cp.ID)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("kept %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Fatalf("kept %v, want %v", ids, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSimplifyJourney(t *testing.T) {
+	j := &models.Journey{Checkpoints: track([2]float64{0, 0}, [2]float64{100, 0}, [2]float64{200, 0})}
+
+	if view := simplifyJourney(j, 0); view != nil || len(j.Checkpoints) != 3 {
+		t.Errorf("tolerance 0 = %+v with %d points, want nil and the journey untouched", view, len(j.Checkpoints))
+	}
+
+	view := simplifyJourney(j, 10)
+	if view == nil || view.OriginalPoints != 3 || view.DroppedPoints != 1 || view.ToleranceM != 10 {
+		t.Errorf("simplifyJourney = %+v, want 1 of 3 points dropped", view)
+	}
+	if len(j.Checkpoints) != 2 {
+		t.Errorf("journey has %d checkpoints, want 2", len(j.Checkpoints))
+	}
+}
+
+func TestSegmentDistance(t *testing.T) {
+	tests := []struct {
+		name string
+		p    [2]float64
+		a, b [2]float64
+		want float64
+	}{
+		{"perpendicular", [2]float64{5, 3}, [2]float64{0, 0}, [2]float64{10, 0}, 3},
+		{"past the end", [2]float64{13, 4}, [2]float64{0, 0}, [2]float64{10, 0}, 5},
+		{"before the start", [2]float64{-3, -4}, [2]float64{0, 0}, [2]float64{10, 0}, 5},
+		{"degenerate segment", [2]float64{3, 4}, [2]float64{0, 0}, [2]float64{0, 0}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := segmentDistance(tt.p[0], tt.p[1], tt.a[0], tt.a[1], tt.b[0], tt.b[1])
+			if got != tt.want {
+				t.Errorf("segmentDistance = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"github.com/Mahaveer86619/TrailStory/pkg/errz"
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/views"
+	"github.com/paulmach/orb"
+)
+
+// Segments slower than this (m/s) count as stopped when computing moving time.
+const movingSpeedThreshold = 0.5
+
+// journeyStatsQuery computes per-journey statistics entirely in PostGIS.
+// Distances are measured on the geography type, between consecutive
+// checkpoints in time order.
+const journeyStatsQuery = `
+WITH ordered AS (
+	SELECT
+		id,
+		journey_id,
+		location,
+		timestamp,
+		LAG(location) OVER w AS prev_location,
+		LAG(timestamp) OVER w AS prev_timestamp
+	FROM checkpoints
+	WHERE deleted_at IS NULL AND journey_id IN (?)
+	WINDOW w AS (PARTITION BY journey_id ORDER BY timestamp, id)
+), segments AS (
+	SELECT
+		id,
+		journey_id,
+		location,
+		timestamp,
+		COALESCE(ST_Distance(prev_location::geography, location::geography), 0) AS distance,
+		COALESCE(EXTRACT(EPOCH FROM timestamp - prev_timestamp), 0) AS duration
+	FROM ordered
+)
+SELECT
+	journey_id,
+	COUNT(*) AS checkpoint_count,
+	SUM(distance) AS distance_m,
+	EXTRACT(EPOCH FROM MAX(timestamp) - MIN(timestamp)) AS elapsed_s,
+	SUM(CASE WHEN duration > 0 AND distance / duration >= ? THEN duration ELSE 0 END) AS moving_s,
+	ST_XMin(ST_Extent(location)) AS min_lng,
+	ST_YMin(ST_Extent(location)) AS min_lat,
+	ST_XMax(ST_Extent(location)) AS max_lng,
+	ST_YMax(ST_Extent(location)) AS max_lat,
+	ST_X(ST_Centroid(ST_Collect(location))) AS centroid_lng,
+	ST_Y(ST_Centroid(ST_Collect(location))) AS centroid_lat,
+	(ARRAY_AGG(ST_X(location) ORDER BY timestamp, id))[1] AS first_lng,
+	(ARRAY_AGG(ST_Y(location) ORDER BY timestamp, id))[1] AS first_lat
+FROM segments
+GROUP BY journey_id
+`
+
+// journeyCoversQuery picks the first image of each journey, in checkpoint
+// order, for list summaries.
+const journeyCoversQuery = `
+SELECT DISTINCT ON (checkpoints.journey_id)
+	checkpoints.journey_id,
+	media.id AS media_id
+FROM media
+JOIN checkpoints ON checkpoints.id = media.checkpoint_id
+WHERE checkpoints.deleted_at IS NULL
+	AND media.deleted_at IS NULL
+	AND media.type = 'image'
+	AND checkpoints.journey_id IN (?)
+ORDER BY checkpoints.journey_id, checkpoints.timestamp, checkpoints.id, media.id
+`
+
+type journeyStatsRow struct {
+	JourneyID       uint
+	CheckpointCount int
+	DistanceM       float64
+	ElapsedS        float64
+	MovingS         float64
+	MinLng          float64
+	MinLat          float64
+	MaxLng          float64
+	MaxLat          float64
+	CentroidLng     float64
+	CentroidLat     float64
+	FirstLng        float64
+	FirstLat        float64
+}
+
+type journeyCoverRow struct {
+	JourneyID uint
+	MediaID   uint
+}
+
+// journeyStats returns statistics keyed by journey ID. Journeys without
+// checkpoints are absent from the map.
+func (s *JourneyService) journeyStats(journeyIDs []uint) (map[uint]journeyStatsRow, error) {
+	stats := map[uint]journeyStatsRow{}
+	if len(journeyIDs) == 0 {
+		return stats, nil
+	}
+
+	var rows []journeyStatsRow
+	if err := s.DB.Raw(journeyStatsQuery, journeyIDs, movingSpeedThreshold).Scan(&rows).Error; err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to compute journey statistics", err)
+	}
+
+	for _, row := range rows {
+		stats[row.JourneyID] = row
+	}
+	return stats, nil
+}
+
+func (row journeyStatsRow) view() *views.JourneyStats {
+	// Average over moving time so breaks don't drag the figure down
+	avgSpeed := 0.0
+	switch {
+	case row.MovingS > 0:
+		avgSpeed = row.DistanceM / row.MovingS
+	case row.ElapsedS > 0:
+		avgSpeed = row.DistanceM / row.ElapsedS
+	}
+
+	return &views.JourneyStats{
+		CheckpointCount: row.CheckpointCount,
+		DistanceM:       row.DistanceM,
+		ElapsedS:        int64(row.ElapsedS),
+		MovingS:         int64(row.MovingS),
+		AvgSpeedMps:     avgSpeed,
+		BBox:            []float64{row.MinLng, row.MinLat, row.MaxLng, row.MaxLat},
+		Centroid:        []float64{row.CentroidLat, row.CentroidLng},
+	}
+}
+
+// attachStats fills the Stats of each view from the journey at the same index.
+func (s *JourneyService) attachStats(journeys []models.Journey, list []views.JourneyView) error {
+	stats, err := s.journeyStats(journeyIDs(journeys))
+	if err != nil {
+		return err
+	}
+
+	for i, j := range journeys {
+		if row, ok := stats[j.ID]; ok {
+			list[i].Stats = row.view()
+		}
+	}
+	return nil
+}
+
+// toJourneySummaries renders journeys for list endpoints without loading
+// their checkpoints: statistics, the start time zone and the cover image are
+// all computed in SQL.
+func (s *JourneyService) toJourneySummaries(journeys []models.Journey) ([]views.JourneyView, error) {
+	ids := journeyIDs(journeys)
+	stats, err := s.journeyStats(ids)
+	if err != nil {
+		return nil, err
+	}
+	covers, err := s.journeyCovers(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]views.JourneyView, 0, len(journeys))
+	for i := range journeys {
+		j := &journeys[i]
+
+		var first *orb.Point
+		row, ok := stats[j.ID]
+		if ok {
+			first = &orb.Point{row.FirstLng, row.FirstLat}
+		}
+
+		view := views.ToJourneySummaryView(j, first, covers[j.ID], s.Storage)
+		if ok {
+			view.Stats = row.view()
+		}
+		list = append(list, view)
+	}
+	return list, nil
+}
+
+// journeyCovers returns the first image of each journey that has one.
+func (s *JourneyService) journeyCovers(journeyIDs []uint) (map[uint]*models.Media, error) {
+	covers := map[uint]*models.Media{}
+	if len(journeyIDs) == 0 {
+		return covers, nil
+	}
+
+	var rows []journeyCoverRow
+	if err := s.DB.Raw(journeyCoversQuery, journeyIDs).Scan(&rows).Error; err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to fetch journey covers", err)
+	}
+	if len(rows) == 0 {
+		return covers, nil
+	}
+
+	mediaIDs := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		mediaIDs = append(mediaIDs, row.MediaID)
+	}
+	var media []models.Media
+	if err := s.DB.Where("id IN ?", mediaIDs).Find(&media).Error; err != nil {
+		return nil, errz.New(errz.InternalServerError, "Failed to fetch journey covers", err)
+	}
+	byID := make(map[uint]*models.Media, len(media))
+	for i := range media {
+		byID[media[i].ID] = &media[i]
+	}
+
+	for _, row := range rows {
+		if m, ok := byID[row.MediaID]; ok {
+			covers[row.JourneyID] = m
+		}
+	}
+	return covers, nil
+}
+
+func journeyIDs(journeys []models.Journey) []uint {
+	ids := make([]uint, 0, len(journeys))
+	for _, j := range journeys {
+		ids = append(ids, j.ID)
+	}
+	return ids
+}
@@ -1,21 +1,35 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid or expired signature")
+	ErrSizeMismatch     = errors.New("upload size does not match the signed size")
+	ErrExists           = errors.New("an object is already stored under this key")
 )
 
 type LocalStorage struct {
 	basePath string
+	secret   string // Signs upload URLs
 }
 
-func NewLocalStorage(basePath string) *LocalStorage {
+func NewLocalStorage(basePath string, secret string) *LocalStorage {
 	if basePath == "" {
 		basePath = "./uploads"
 	}
-	return &LocalStorage{basePath: basePath}
+	return &LocalStorage{basePath: basePath, secret: secret}
 }
 
 func (s *LocalStorage) Init() error {
@@ -29,7 +43,12 @@ Storing Format ->
 uploads/
   journeys/{journey_id}/
     checkpoints/{checkpoint_id}/
-      original.jpg
+      {random}.jpg
+  users/{user_id}/
+    {random}.jpg
+
+Keys made before names were generated may hold the uploaded file name;
+they still resolve, as keys are only ever looked up, never parsed.
 
 */
 
@@ -52,7 +71,7 @@ func (s *LocalStorage) SaveMedia(
 		return "", err
 	}
 
-	dstPath := filepath.Join(dir, filename)
+	dstPath := filepath.Join(dir, newObjectName(filename))
 
 	out, err := os.Create(dstPath)
 	if err != nil {
@@ -67,7 +86,7 @@ func (s *LocalStorage) SaveMedia(
 	// storageKey is relative path
 	storageKey, _ := filepath.Rel(s.basePath, dstPath)
 
-	return storageKey, nil
+	return filepath.ToSlash(storageKey), nil
 }
 
 func (s *LocalStorage) SaveProfilePic(userID string, filename string, file io.Reader) (string, error) {
@@ -75,7 +94,7 @@ func (s *LocalStorage) SaveProfilePic(userID string, filename string, file io.Re
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return "", err
 	}
-	dstPath := filepath.Join(dir, filename)
+	dstPath := filepath.Join(dir, newObjectName(filename))
 	out, err := os.Create(dstPath)
 	if err != nil {
 		return "", err
@@ -84,7 +103,191 @@ func (s *LocalStorage) SaveProfilePic(userID string, filename string, file io.Re
 	if _, err := io.Copy(out, file); err != nil {
 		return "", err
 	}
-	return filepath.Rel(s.basePath, dstPath)
+	storageKey, err := filepath.Rel(s.basePath, dstPath)
+	return filepath.ToSlash(storageKey), err
+}
+
+func (s *LocalStorage) Open(storageKey string) (io.ReadCloser, error) {
+	path, err := s.path(storageKey)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Stat reports no content type; local files keep none.
+func (s *LocalStorage) Stat(storageKey string) (*ObjectInfo, error) {
+	path, err := s.path(storageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{Key: storageKey, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete also removes the folders the file leaves empty.
+func (s *LocalStorage) Delete(storageKey string) error {
+	path, err := s.path(storageKey)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	base := filepath.Clean(s.basePath)
+	for dir := filepath.Dir(path); dir != base && strings.HasPrefix(dir, base); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break // Not empty
+		}
+	}
+	return nil
+}
+
+// List only accepts a prefix that names a folder, such as "journeys/".
+func (s *LocalStorage) List(prefix string, fn func(ObjectInfo) error) error {
+	root, err := s.path(prefix)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == root {
+			return nil // Nothing stored under the prefix yet
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.basePath, path)
+		if err != nil {
+			return err
+		}
+		return fn(ObjectInfo{Key: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+	})
+}
+
+// PresignUpload returns a signed URL on the API itself, served by
+// handlers.StorageHandler, so clients upload the same way as with S3.
+func (s *LocalStorage) PresignUpload(storageKey string, contentType string, size int64, expires time.Duration) (*UploadTarget, error) {
+	expiresAt := time.Now().Add(expires)
+	sizeParam := strconv.FormatInt(size, 10)
+	expiresParam := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	q := url.Values{}
+	q.Set("key", storageKey)
+	q.Set("content_type", contentType)
+	q.Set("size", sizeParam)
+	q.Set("expires", expiresParam)
+	q.Set("signature", sign(s.secret, http.MethodPut, storageKey, contentType, sizeParam, expiresParam))
+
+	return &UploadTarget{
+		URL:       "/storage/upload?" + q.Encode(),
+		Method:    http.MethodPut,
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// SignedUpload is what an upload URL from PresignUpload allows.
+type SignedUpload struct {
+	Key         string
+	ContentType string
+	Size        int64
+}
+
+// VerifyUpload checks the signature and expiry of an upload URL's query.
+func (s *LocalStorage) VerifyUpload(q url.Values) (*SignedUpload, error) {
+	key, contentType := q.Get("key"), q.Get("content_type")
+	sizeParam, expiresParam := q.Get("size"), q.Get("expires")
+
+	if !validSignature(s.secret, q.Get("signature"), http.MethodPut, key, contentType, sizeParam, expiresParam) {
+		return nil, ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(expiresParam, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, ErrInvalidSignature
+	}
+	size, err := strconv.ParseInt(sizeParam, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	return &SignedUpload{Key: key, ContentType: contentType, Size: size}, nil
+}
+
+// Put stores exactly size bytes from r under storageKey. The file only
+// appears once complete, so Stat never sees a partial upload.
+func (s *LocalStorage) Put(storageKey string, r io.Reader, size int64) error {
+	return s.write(storageKey, r, size, true)
+}
+
+// Create is Put for direct uploads: it fails with ErrExists rather than
+// replace a stored file, so an upload URL cannot swap the bytes of an upload
+// that was already checked and recorded.
+func (s *LocalStorage) Create(storageKey string, r io.Reader, size int64) error {
+	return s.write(storageKey, r, size, false)
+}
+
+func (s *LocalStorage) write(storageKey string, r io.Reader, size int64, replace bool) error {
+	path, err := s.path(storageKey)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, io.LimitReader(r, size+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return ErrSizeMismatch
+	}
+
+	if replace {
+		return os.Rename(tmp.Name(), path)
+	}
+	// Unlike rename, link refuses to overwrite
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if os.IsExist(err) {
+			return ErrExists
+		}
+		return err
+	}
+	return nil
+}
+
+// path resolves a key inside basePath, refusing keys that escape it.
+func (s *LocalStorage) path(storageKey string) (string, error) {
+	path := filepath.Join(s.basePath, filepath.FromSlash(storageKey))
+	rel, err := filepath.Rel(s.basePath, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid storage key %q", storageKey)
+	}
+	return path, nil
 }
 
 func (s *LocalStorage) GetPublicURL(storageKey string) string {
@@ -92,6 +295,31 @@ func (s *LocalStorage) GetPublicURL(storageKey string) string {
 	return fmt.Sprintf("/static/%s", storageKey)
 }
 
+// GetSignedURL points at the /static handler, which checks the signature
+// with VerifyURL.
+func (s *LocalStorage) GetSignedURL(storageKey string, expires time.Duration) string {
+	expiresParam := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+
+	q := url.Values{}
+	q.Set("expires", expiresParam)
+	q.Set("signature", sign(s.secret, http.MethodGet, storageKey, expiresParam))
+	return s.GetPublicURL(storageKey) + "?" + q.Encode()
+}
+
+// VerifyURL checks the query of a URL from GetSignedURL against the key it
+// was requested with.
+func (s *LocalStorage) VerifyURL(storageKey string, q url.Values) error {
+	expiresParam := q.Get("expires")
+	if !validSignature(s.secret, q.Get("signature"), http.MethodGet, storageKey, expiresParam) {
+		return ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(expiresParam, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
 func (s *LocalStorage) HealthCheck() error {
 	_, err := os.Stat(s.basePath)
 	return err
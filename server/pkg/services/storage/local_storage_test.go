@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+// query parses the query of a signed URL.
+func query(t *testing.T, rawURL string) url.Values {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
+
+// with returns a copy of q with name set to value.
+func with(q url.Values, name, value string) url.Values {
+	c := url.Values{}
+	for k, v := range q {
+		c[k] = v
+	}
+	c.Set(name, value)
+	return c
+}
+
+func unix(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func TestVerifyURL(t *testing.T) {
+	s := NewLocalStorage(t.TempDir(), testSecret)
+	key := "journeys/1/checkpoints/2/photo.jpg"
+	valid := query(t, s.GetSignedURL(key, time.Hour))
+	expired := unix(time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name string
+		key  string
+		q    url.Values
+		want error
+	}{
+		{"valid", key, valid, nil},
+		{"other key", "journeys/1/checkpoints/2/other.jpg", valid, ErrInvalidSignature},
+		{"extended expiry", key, with(valid, "expires", unix(time.Now().Add(48*time.Hour))), ErrInvalidSignature},
+		{"tampered signature", key, with(valid, "signature", strings.Repeat("0", 64)), ErrInvalidSignature},
+		{"no signature", key, url.Values{"expires": valid["expires"]}, ErrInvalidSignature},
+		{"expired", key, url.Values{"expires": {expired}, "signature": {sign(testSecret, http.MethodGet, key, expired)}}, ErrInvalidSignature},
+		{"signed with another secret", key, query(t, NewLocalStorage(t.TempDir(), "other").GetSignedURL(key, time.Hour)), ErrInvalidSignature},
+		{"signed for upload", key, with(valid, "signature", sign(testSecret, http.MethodPut, key, valid.Get("expires"))), ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.VerifyURL(tt.key, tt.q); !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("VerifyURL = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyUpload(t *testing.T) {
+	s := NewLocalStorage(t.TempDir(), testSecret)
+	key := "journeys/1/upload_abc.jpg"
+	target, err := s.PresignUpload(key, "image/jpeg", 1024, time.Hour)
+	if err != nil {
+		t.Fatalf("PresignUpload: %v", err)
+	}
+	valid := query(t, target.URL)
+
+	expired := url.Values{
+		"key":          {key},
+		"content_type": {"image/jpeg"},
+		"size":         {"1024"},
+		"expires":      {unix(time.Now().Add(-time.Minute))},
+	}
+	expired.Set("signature", sign(testSecret, http.MethodPut, key, "image/jpeg", "1024", expired.Get("expires")))
+
+	tests := []struct {
+		name string
+		q    url.Values
+		want error
+	}{
+		{"valid", valid, nil},
+		{"other key", with(valid, "key", "journeys/2/upload_abc.jpg"), ErrInvalidSignature},
+		{"larger size", with(valid, "size", "1073741824"), ErrInvalidSignature},
+		{"other content type", with(valid, "content_type", "text/html"), ErrInvalidSignature},
+		{"extended expiry", with(valid, "expires", unix(time.Now().Add(48*time.Hour))), ErrInvalidSignature},
+		{"expired", expired, ErrInvalidSignature},
+		{"download url", query(t, s.GetSignedURL(key, time.Hour)), ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upload, err := s.VerifyUpload(tt.q)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("VerifyUpload = %v, want %v", err, tt.want)
+			}
+			if err == nil && (upload.Key != key || upload.ContentType != "image/jpeg" || upload.Size != 1024) {
+				t.Errorf("VerifyUpload = %+v", upload)
+			}
+		})
+	}
+}
+
+func TestCreateRefusesToReplace(t *testing.T) {
+	s := NewLocalStorage(t.TempDir(), testSecret)
+	key := "journeys/1/upload_abc.jpg"
+
+	if err := s.Create(key, strings.NewReader("first"), 5); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := s.Create(key, strings.NewReader("other"), 5); !errors.Is(err, ErrExists) {
+		t.Errorf("second Create = %v, want ErrExists", err)
+	}
+	if err := s.Create("journeys/1/upload_short.jpg", strings.NewReader("abc"), 5); !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("Create of a short body = %v, want ErrSizeMismatch", err)
+	}
+	if _, err := s.Stat("journeys/1/upload_short.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after a failed Create = %v, want ErrNotFound", err)
+	}
+}
+
+func TestKeysCannotEscapeBasePath(t *testing.T) {
+	s := NewLocalStorage(t.TempDir(), testSecret)
+
+	for _, key := range []string{"../secret", "journeys/../../secret", ".."} {
+		if _, err := s.Open(key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Open(%q) = %v, want an invalid key error", key, err)
+		}
+		if err := s.Put(key, strings.NewReader("x"), 1); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+}
@@ -2,8 +2,12 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"os"
+	"time"
 
 	"github.com/Mahaveer86619/TrailStory/pkg/config"
 
@@ -14,11 +18,27 @@ import (
 )
 
 type S3Storage struct {
-	client *s3.Client
-	bucket string
+	client    *s3.Client
+	presigner *s3.PresignClient
+	bucket    string
 }
 
 func NewS3Storage(cfg *config.Config) *S3Storage {
+	// Presigned URLs are used by browsers, so they must name the public
+	// endpoint; the host is part of the signature.
+	publicEndpoint := cfg.S3_PUBLIC_URL
+	if publicEndpoint == "" {
+		publicEndpoint = cfg.S3_ENDPOINT
+	}
+
+	return &S3Storage{
+		client:    newS3Client(cfg, cfg.S3_ENDPOINT),
+		presigner: s3.NewPresignClient(newS3Client(cfg, publicEndpoint)),
+		bucket:    cfg.S3_BUCKET,
+	}
+}
+
+func newS3Client(cfg *config.Config, endpoint string) *s3.Client {
 	awsCfg := aws.Config{
 		Region: cfg.S3_REGION,
 		Credentials: credentials.NewStaticCredentialsProvider(
@@ -29,19 +49,14 @@ func NewS3Storage(cfg *config.Config) *S3Storage {
 		EndpointResolverWithOptions: aws.EndpointResolverWithOptionsFunc(
 			func(service, region string, _ ...interface{}) (aws.Endpoint, error) {
 				return aws.Endpoint{
-					URL:               cfg.S3_ENDPOINT,
+					URL:               endpoint,
 					HostnameImmutable: true,
 				}, nil
 			},
 		),
 	}
 
-	client := s3.NewFromConfig(awsCfg)
-
-	return &S3Storage{
-		client: client,
-		bucket: cfg.S3_BUCKET,
-	}
+	return s3.NewFromConfig(awsCfg)
 }
 
 func (s *S3Storage) Init() error {
@@ -62,7 +77,22 @@ func (s *S3Storage) Init() error {
 		fmt.Printf("Bucket %s created successfully.\n", s.bucket)
 	}
 
-	// 3. Apply CORS Policy (Fixes the browser image loading error)
+	// 3. Block public access. Every URL we hand out is signed, and buckets
+	// made public before that must be closed too
+	_, err = s.client.PutPublicAccessBlock(context.TODO(), &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(s.bucket),
+		PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to block public access: %w", err)
+	}
+
+	// 4. Apply CORS Policy (Fixes the browser image loading error)
 	fmt.Printf("Applying CORS policy to bucket %s...\n", s.bucket)
 	_, err = s.client.PutBucketCors(context.TODO(), &s3.PutBucketCorsInput{
 		Bucket: aws.String(s.bucket),
@@ -93,17 +123,18 @@ func (s *S3Storage) SaveMedia(
 	file io.Reader,
 ) (string, error) {
 
-	key := fmt.Sprintf(
-		"journeys/%s/checkpoints/%s/%s",
-		journeyID,
-		checkpointID,
-		filename,
-	)
+	key := MediaKey(journeyID, checkpointID, newObjectName(filename))
+
+	body, cleanup, err := seekable(file)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
 
-	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
+	_, err = s.client.PutObject(context.TODO(), &s3.PutObjectInput{
 		Bucket: &s.bucket,
 		Key:    &key,
-		Body:   file,
+		Body:   body,
 	})
 
 	if err != nil {
@@ -114,22 +145,178 @@ func (s *S3Storage) SaveMedia(
 }
 
 func (s *S3Storage) SaveProfilePic(userID string, filename string, file io.Reader) (string, error) {
-	key := fmt.Sprintf("users/%s/profile_%s", userID, filename)
-	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
+	key := fmt.Sprintf("users/%s/profile_%s", userID, newObjectName(filename))
+	body, cleanup, err := seekable(file)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	_, err = s.client.PutObject(context.TODO(), &s3.PutObjectInput{
 		Bucket: &s.bucket,
 		Key:    &key,
-		Body:   file,
+		Body:   body,
 	})
 	return key, err
 }
 
+func (s *S3Storage) Put(storageKey string, file io.Reader, size int64) error {
+	body, cleanup, err := seekable(file)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	_, err = s.client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:        &s.bucket,
+		Key:           &storageKey,
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	return err
+}
+
+// seekable spools a stream to a temporary file unless it can already seek.
+// Without TLS the SDK checksums the body up front and must rewind it after.
+func seekable(file io.Reader) (io.ReadSeeker, func(), error) {
+	if rs, ok := file.(io.ReadSeeker); ok {
+		return rs, func() {}, nil
+	}
+
+	tmp, err := os.CreateTemp("", "trailstory-s3-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	if _, err := io.Copy(tmp, file); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return tmp, cleanup, nil
+}
+
+func (s *S3Storage) Open(storageKey string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &storageKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *S3Storage) PresignUpload(storageKey string, contentType string, size int64, expires time.Duration) (*UploadTarget, error) {
+	req, err := s.presigner.PresignPutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:        &s.bucket,
+		Key:           &storageKey,
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+		IfNoneMatch:   aws.String("*"), // Write-once; S3 refuses with 412 if the key exists
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return nil, err
+	}
+
+	// Host and Content-Length are set by the client's HTTP stack
+	headers := map[string]string{}
+	for name, values := range req.SignedHeader {
+		if name == "Host" || name == "Content-Length" || len(values) == 0 {
+			continue
+		}
+		headers[name] = values[0]
+	}
+
+	return &UploadTarget{
+		URL:       req.URL,
+		Method:    req.Method,
+		Headers:   headers,
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+func (s *S3Storage) Stat(storageKey string) (*ObjectInfo, error) {
+	out, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: &s.bucket,
+		Key:    &storageKey,
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:         storageKey,
+		Size:        aws.ToInt64(out.ContentLength),
+		ContentType: aws.ToString(out.ContentType),
+		ModTime:     aws.ToTime(out.LastModified),
+	}, nil
+}
+
+func (s *S3Storage) Delete(storageKey string) error {
+	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: &s.bucket,
+		Key:    &storageKey,
+	})
+	return err
+}
+
+func (s *S3Storage) List(prefix string, fn func(ObjectInfo) error) error {
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: &s.bucket,
+		Prefix: &prefix,
+	})
+
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(context.TODO())
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range page.Contents {
+			err := fn(ObjectInfo{
+				Key:     aws.ToString(obj.Key),
+				Size:    aws.ToInt64(obj.Size),
+				ModTime: aws.ToTime(obj.LastModified),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetPublicURL signs even public files: the bucket is kept private, so that
+// dropping the query from a signed link of a private journey's file does not
+// leave a permanent URL. Public files get a longer expiry, which also means
+// no objects need to move when a journey's visibility changes.
 func (s *S3Storage) GetPublicURL(storageKey string) string {
-	return fmt.Sprintf(
-		"%s/%s/%s",
-		config.AppConfig.S3_PUBLIC_URL,
-		s.bucket,
-		storageKey,
-	)
+	return s.GetSignedURL(storageKey, PublicURLExpiry)
+}
+
+func (s *S3Storage) GetSignedURL(storageKey string, expires time.Duration) string {
+	req, err := s.presigner.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &storageKey,
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		// Never fall back to the permanent URL
+		log.Printf("Failed to presign %s: %v", storageKey, err)
+		return ""
+	}
+	return req.URL
 }
 
 func (s *S3Storage) HealthCheck() error {
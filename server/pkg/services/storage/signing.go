@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// sign returns a hex HMAC-SHA256 of parts, joined by newlines.
+func sign(secret string, parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validSignature(secret string, signature string, parts ...string) bool {
+	return hmac.Equal([]byte(signature), []byte(sign(secret, parts...)))
+}
@@ -1,14 +1,40 @@
 package storage
 
 import (
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/Mahaveer86619/TrailStory/pkg/config"
 )
 
+// ErrNotFound is returned by Stat when nothing is stored under a key.
+var ErrNotFound = errors.New("object not found")
+
+// UploadTarget is where a client sends a file directly, bypassing the API.
+type UploadTarget struct {
+	URL       string
+	Method    string
+	Headers   map[string]string // Signed; must be sent exactly as given
+	ExpiresAt time.Time
+}
+
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string // As declared by the uploader, empty if unknown
+	ModTime     time.Time
+}
+
 type StorageService interface {
 	Init() error
 
+	// SaveMedia and SaveProfilePic store a file under a new key of their own
+	// and return it. The file name only lends its extension.
 	SaveMedia(
 		journeyID string,
 		checkpointID string,
@@ -17,21 +43,131 @@ type StorageService interface {
 	) (string, error)
 
 	SaveProfilePic(userID string, filename string, file io.Reader) (string, error)
-	
+
+	// Put stores exactly size bytes from file under storageKey, replacing
+	// any object there. Used to copy objects between drivers.
+	Put(storageKey string, file io.Reader, size int64) error
+
+	// Open reads back a stored object. The caller must close it.
+	Open(storageKey string) (io.ReadCloser, error)
+
+	// PresignUpload issues a URL the client can PUT exactly size bytes of
+	// contentType to. The object lands under storageKey, which must be free:
+	// the URL cannot replace an object, so it is useless once the upload is
+	// stored.
+	PresignUpload(storageKey string, contentType string, size int64, expires time.Duration) (*UploadTarget, error)
+
+	// Stat describes a stored object, or returns ErrNotFound.
+	Stat(storageKey string) (*ObjectInfo, error)
+
+	// Delete removes a stored object. Deleting a missing key is not an error.
+	Delete(storageKey string) error
+
+	// List calls fn for every object stored under prefix, without its
+	// content type, in no particular order. An error from fn stops the
+	// listing and is returned.
+	List(prefix string, fn func(ObjectInfo) error) error
+
+	// GetPublicURL returns a URL for files anyone may see. Drivers that
+	// cannot serve files publicly sign it for PublicURLExpiry instead.
 	GetPublicURL(storageKey string) string
 
+	// GetSignedURL returns a URL that stops working after expires.
+	GetSignedURL(storageKey string, expires time.Duration) string
+
 	HealthCheck() error
 }
 
 func NewStorageService() StorageService {
 	cfg := config.AppConfig
 
-	switch cfg.STORAGE_DRIVER {
+	return NewDriver(cfg.STORAGE_DRIVER, &cfg)
+}
+
+// NewDriver builds the named driver ("s3" or "local") from cfg, for tools
+// that work with more than the configured one.
+func NewDriver(driver string, cfg *config.Config) StorageService {
+	switch driver {
 	case "s3":
-		return NewS3Storage(&cfg)
+		return NewS3Storage(cfg)
 	case "local":
 		fallthrough
 	default:
-		return NewLocalStorage(cfg.STORAGE_PATH)
+		return NewLocalStorage(cfg.STORAGE_PATH, signingSecret(cfg))
+	}
+}
+
+// SignedURLExpiry is how long signed media URLs handed out in views last.
+const SignedURLExpiry = time.Hour
+
+// PublicURLExpiry is how long URLs of public files last on drivers that
+// must sign every URL. It bounds how long a journey made private stays
+// reachable through links handed out before.
+const PublicURLExpiry = 24 * time.Hour
+
+// Signed wraps a StorageService so GetPublicURL hands out signed URLs that
+// expire, for media that must not be reachable through a permanent link.
+func Signed(store StorageService, expires time.Duration) StorageService {
+	return signedStorage{StorageService: store, expires: expires}
+}
+
+type signedStorage struct {
+	StorageService
+	expires time.Duration
+}
+
+func (s signedStorage) GetPublicURL(storageKey string) string {
+	return s.GetSignedURL(storageKey, s.expires)
+}
+
+// Prefixes lists the top-level folders this app stores objects in. Anything
+// else in a shared bucket belongs to someone else.
+var Prefixes = []string{"journeys/", "users/", "media/"}
+
+// MediaKey is the key SaveMedia stores a checkpoint file under.
+func MediaKey(journeyID string, checkpointID string, filename string) string {
+	return fmt.Sprintf("journeys/%s/checkpoints/%s/%s", journeyID, checkpointID, filename)
+}
+
+// newObjectName replaces a client's file name with a random one, keeping a
+// normalized extension, so names can neither leave their folder nor collide.
+func newObjectName(filename string) string {
+	return strings.ToLower(rand.Text()) + safeExt(filename)
+}
+
+// safeExt is the lowercased extension of filename if it is short and
+// alphanumeric, "" otherwise.
+func safeExt(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if len(ext) < 2 || len(ext) > 10 {
+		return ""
+	}
+	for _, c := range ext[1:] {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// ContentKey is the key of a content-addressed object. Files with the same
+// SHA-256 share it, whichever checkpoint or journey they were uploaded to.
+func ContentKey(sum string, filename string) string {
+	return fmt.Sprintf("media/%s/%s/%s", sum[:2], sum, filename)
+}
+
+// ContentSum returns the SHA-256 a ContentKey was built from.
+func ContentSum(key string) (string, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 4 || parts[0] != "media" || len(parts[2]) != 64 || parts[1] != parts[2][:2] {
+		return "", false
+	}
+	return parts[2], true
+}
+
+func signingSecret(cfg *config.Config) string {
+	if cfg.STORAGE_SIGNING_SECRET != "" {
+		return cfg.STORAGE_SIGNING_SECRET
 	}
+	return cfg.JWT_SECRET
 }
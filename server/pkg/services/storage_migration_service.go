@@ -0,0 +1,203 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/db"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+
+	"gorm.io/gorm"
+)
+
+var ErrChecksumMismatch = errors.New("checksum mismatch after copy")
+
+type MigrationReport struct {
+	Referenced int
+	Copied     int
+	Skipped    int // Already copied by an earlier run
+	Missing    int // Referenced but not in the source
+	Failed     int
+	Bytes      int64 // Copied, or that would be copied in a dry run
+}
+
+// StorageMigration copies every referenced object from one storage driver
+// to another under the same key, so the database needs no changes.
+type StorageMigration struct {
+	DB      *gorm.DB
+	From    storage.StorageService
+	To      storage.StorageService
+	Route   string // Such as "local -> s3"; a journal only resumes the same route
+	Journal string // A route header, then one "<sha256>  <key>" line per verified copy
+}
+
+func NewStorageMigration(from, to storage.StorageService, route, journal string) *StorageMigration {
+	return &StorageMigration{
+		DB:      db.GetTrailStoryDB().DB,
+		From:    from,
+		To:      to,
+		Route:   route,
+		Journal: journal,
+	}
+}
+
+const journalHeader = "# route: "
+
+// Run copies each object and reads it back from the destination to compare
+// SHA-256 checksums. Verified copies are appended to the journal, so an
+// interrupted run resumes where it stopped. With dryRun nothing is written.
+func (m *StorageMigration) Run(dryRun bool) (*MigrationReport, error) {
+	refs, err := referencedKeys(m.DB)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(refs))
+	for key := range refs {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	route, done, err := readJournal(m.Journal)
+	if err != nil {
+		return nil, err
+	}
+	if route != "" && route != m.Route {
+		return nil, fmt.Errorf("journal %s records a %s migration, not %s; pick another -journal", m.Journal, route, m.Route)
+	}
+
+	var journal *os.File
+	if !dryRun {
+		if journal, err = os.OpenFile(m.Journal, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+			return nil, err
+		}
+		defer journal.Close()
+
+		if route == "" {
+			if _, err := fmt.Fprintf(journal, "%s%s\n", journalHeader, m.Route); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	report := &MigrationReport{Referenced: len(keys)}
+	for _, key := range keys {
+		info, err := m.From.Stat(key)
+		if errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Missing in source: %s", key)
+			report.Missing++
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to stat %s: %v", key, err)
+			report.Failed++
+			continue
+		}
+
+		// Trust the journal only while the copy is still there
+		if _, ok := done[key]; ok {
+			copied, err := m.To.Stat(key)
+			if err == nil && copied.Size == info.Size {
+				report.Skipped++
+				continue
+			}
+			log.Printf("Copied before but missing or changed in destination, copying again: %s", key)
+		}
+
+		if dryRun {
+			log.Printf("Would copy %s (%d bytes)", key, info.Size)
+			report.Bytes += info.Size
+			continue
+		}
+
+		sum, err := m.copy(key, info.Size)
+		if err != nil {
+			log.Printf("Failed to copy %s: %v", key, err)
+			report.Failed++
+			continue
+		}
+		if _, err := fmt.Fprintf(journal, "%s  %s\n", sum, key); err != nil {
+			return report, err
+		}
+		report.Copied++
+		report.Bytes += info.Size
+	}
+	return report, nil
+}
+
+// copy streams one object across and verifies the stored copy.
+func (m *StorageMigration) copy(key string, size int64) (string, error) {
+	src, err := m.From.Open(key)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	hash := sha256.New()
+	if err := m.To.Put(key, io.TeeReader(src, hash), size); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	copied, err := checksum(m.To, key)
+	if err != nil {
+		return "", err
+	}
+	if copied != sum {
+		return "", fmt.Errorf("%w: source %s, destination %s", ErrChecksumMismatch, sum, copied)
+	}
+	return sum, nil
+}
+
+func checksum(store storage.StorageService, key string) (string, error) {
+	file, err := store.Open(key)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readJournal loads the route and the keys copied by earlier runs with their
+// checksums. A missing journal means a fresh start.
+func readJournal(path string) (string, map[string]string, error) {
+	done := map[string]string{}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", done, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return "", done, scanner.Err()
+	}
+	route, ok := strings.CutPrefix(scanner.Text(), journalHeader)
+	if !ok {
+		return "", nil, fmt.Errorf("journal %s does not say which route it records", path)
+	}
+
+	for scanner.Scan() {
+		sum, key, ok := strings.Cut(scanner.Text(), "  ")
+		if ok {
+			done[key] = sum
+		}
+	}
+	return route, done, scanner.Err()
+}
@@ -0,0 +1,206 @@
+package upload
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// Kinds of media we accept. Stored as Media.Type.
+const (
+	KindImage = "image"
+	KindVideo = "video"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported file type")
+	ErrTooLarge        = errors.New("file is too large")
+)
+
+// Allowed content types, as sniffed from the file bytes, and their kind.
+var contentTypes = map[string]string{
+	"image/jpeg": KindImage,
+	"image/png":  KindImage,
+	"image/gif":  KindImage,
+	"image/webp": KindImage,
+	"image/heic": KindImage,
+	"image/avif": KindImage,
+
+	"video/mp4":       KindVideo,
+	"video/quicktime": KindVideo,
+	"video/webm":      KindVideo,
+	"video/3gpp":      KindVideo,
+}
+
+var extensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/heic":      ".heic",
+	"image/avif":      ".avif",
+	"video/mp4":       ".mp4",
+	"video/quicktime": ".mov",
+	"video/webm":      ".webm",
+	"video/3gpp":      ".3gp",
+}
+
+// Policy says which kinds an endpoint accepts and how large each may be.
+type Policy struct {
+	MaxBytes   map[string]int64 // Per kind; kinds not listed are refused
+	MaxRequest int64            // Whole request body, for http.MaxBytesReader
+}
+
+var (
+	MediaPolicy = Policy{
+		MaxBytes:   map[string]int64{KindImage: 25 << 20, KindVideo: 500 << 20},
+		MaxRequest: 1 << 30,
+	}
+
+	// Photos become checkpoints from their EXIF, so videos make no sense here
+	PhotoPolicy = Policy{
+		MaxBytes:   map[string]int64{KindImage: 25 << 20},
+		MaxRequest: 1 << 30,
+	}
+
+	AvatarPolicy = Policy{
+		MaxBytes:   map[string]int64{KindImage: 5 << 20},
+		MaxRequest: 6 << 20,
+	}
+)
+
+// File is a validated upload. Reading it yields the full content and fails
+// with ErrTooLarge as soon as the limit for its kind is passed.
+type File struct {
+	ContentType string
+	Kind        string
+
+	reader io.Reader
+	closer io.Closer
+	limit  int64
+	read   int64
+}
+
+// Inspect sniffs the content type from the first bytes of r and checks it
+// against the policy. The declared type and the file name are not trusted.
+func (p Policy) Inspect(r io.Reader) (*File, error) {
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	contentType := sniff(head)
+	kind, ok := contentTypes[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	limit, ok := p.MaxBytes[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+
+	return &File{ContentType: contentType, Kind: kind, reader: br, limit: limit}, nil
+}
+
+// Allow checks a declared content type and size against the policy, before
+// any bytes are seen. Used to hand out direct upload URLs; the stored object
+// is still inspected once the upload completes.
+func (p Policy) Allow(contentType string, size int64) (string, error) {
+	kind, ok := contentTypes[contentType]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	limit, ok := p.MaxBytes[kind]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	if size > limit {
+		return "", (&File{Kind: kind, limit: limit}).tooLarge()
+	}
+	return kind, nil
+}
+
+// Open inspects a multipart file. Its declared size is checked up front so an
+// oversized file is refused before anything is stored.
+func (p Policy) Open(header *multipart.FileHeader) (*File, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := p.Inspect(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if header.Size > f.limit {
+		file.Close()
+		return nil, f.tooLarge()
+	}
+
+	f.closer = file
+	return f, nil
+}
+
+func (f *File) Read(b []byte) (int, error) {
+	n, err := f.reader.Read(b)
+	f.read += int64(n)
+	if f.read > f.limit {
+		return n, f.tooLarge()
+	}
+	return n, err
+}
+
+// Size is the number of bytes read so far; the file size once fully read.
+func (f *File) Size() int64 {
+	return f.read
+}
+
+// Ext is the canonical file extension for the sniffed type.
+func (f *File) Ext() string {
+	return Ext(f.ContentType)
+}
+
+// Ext is the canonical file extension for an allowed content type.
+func Ext(contentType string) string {
+	return extensions[contentType]
+}
+
+func (f *File) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+func (f *File) tooLarge() error {
+	return fmt.Errorf("%w: %s files are limited to %d MB", ErrTooLarge, f.Kind, f.limit>>20)
+}
+
+// sniff extends http.DetectContentType with the ISO media brands it does not
+// know: QuickTime and 3GPP video, and HEIC/AVIF photos from phones.
+func sniff(head []byte) string {
+	if len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")) {
+		switch string(head[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		case "heic", "heix", "heim", "heis", "mif1", "msf1":
+			return "image/heic"
+		case "avif", "avis":
+			return "image/avif"
+		case "3gp4", "3gp5", "3gp6", "3g2a":
+			return "video/3gpp"
+		case "isom", "iso2", "mp41", "mp42", "avc1", "M4V ", "dash":
+			return "video/mp4"
+		}
+	}
+
+	contentType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return contentType
+}
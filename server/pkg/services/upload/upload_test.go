@@ -0,0 +1,180 @@
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+)
+
+var (
+	jpeg = append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, make([]byte, 16)...)
+	png  = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 16)...)
+)
+
+// isoMedia is the start of an ISO base media file with the given major brand.
+func isoMedia(brand string) []byte {
+	return append([]byte("\x00\x00\x00\x18ftyp"+brand), make([]byte, 12)...)
+}
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		content  []byte
+		wantType string
+		wantKind string
+		wantErr  error
+	}{
+		{"jpeg", MediaPolicy, jpeg, "image/jpeg", KindImage, nil},
+		{"png", MediaPolicy, png, "image/png", KindImage, nil},
+		{"heic from a phone", MediaPolicy, isoMedia("heic"), "image/heic", KindImage, nil},
+		{"avif", MediaPolicy, isoMedia("avif"), "image/avif", KindImage, nil},
+		{"quicktime", MediaPolicy, isoMedia("qt  "), "video/quicktime", KindVideo, nil},
+		{"mp4", MediaPolicy, isoMedia("isom"), "video/mp4", KindVideo, nil},
+		{"3gpp", MediaPolicy, isoMedia("3gp5"), "video/3gpp", KindVideo, nil},
+		{"video refused for photos", PhotoPolicy, isoMedia("mp42"), "", "", ErrUnsupportedType},
+		{"video refused for avatars", AvatarPolicy, isoMedia("qt  "), "", "", ErrUnsupportedType},
+		{"unknown iso brand", MediaPolicy, isoMedia("xxxx"), "", "", ErrUnsupportedType},
+		{"html", MediaPolicy, []byte("<html><script>alert(1)</script></html>"), "", "", ErrUnsupportedType},
+		{"pdf", MediaPolicy, []byte("%PDF-1.7\n"), "", "", ErrUnsupportedType},
+		{"empty", MediaPolicy, nil, "", "", ErrUnsupportedType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := tt.policy.Inspect(bytes.NewReader(tt.content))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Inspect error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Inspect: %v", err)
+			}
+			if f.ContentType != tt.wantType || f.Kind != tt.wantKind {
+				t.Errorf("Inspect = %s (%s), want %s (%s)", f.ContentType, f.Kind, tt.wantType, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestInspectKeepsContent(t *testing.T) {
+	f, err := MediaPolicy.Inspect(bytes.NewReader(png))
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, png) || f.Size() != int64(len(png)) {
+		t.Errorf("read %d bytes, Size %d; want the %d sniffed bytes too", len(got), f.Size(), len(png))
+	}
+	if f.Ext() != ".png" {
+		t.Errorf("Ext = %q", f.Ext())
+	}
+}
+
+func TestAllow(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      Policy
+		contentType string
+		size        int64
+		wantKind    string
+		wantErr     error
+	}{
+		{"photo", MediaPolicy, "image/jpeg", 1 << 20, KindImage, nil},
+		{"photo at the limit", MediaPolicy, "image/jpeg", 25 << 20, KindImage, nil},
+		{"photo over the limit", MediaPolicy, "image/jpeg", 25<<20 + 1, "", ErrTooLarge},
+		{"video", MediaPolicy, "video/mp4", 400 << 20, KindVideo, nil},
+		{"video for photos", PhotoPolicy, "video/mp4", 1, "", ErrUnsupportedType},
+		{"large avatar", AvatarPolicy, "image/png", 6 << 20, "", ErrTooLarge},
+		{"declared type with parameters", MediaPolicy, "image/jpeg; charset=binary", 1, "", ErrUnsupportedType},
+		{"unknown type", MediaPolicy, "application/octet-stream", 1, "", ErrUnsupportedType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, err := tt.policy.Allow(tt.contentType, tt.size)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Allow error = %v, want %v", err, tt.wantErr)
+			}
+			if kind != tt.wantKind {
+				t.Errorf("Allow kind = %q, want %q", kind, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestReadStopsAtLimit(t *testing.T) {
+	policy := Policy{MaxBytes: map[string]int64{KindImage: 64}}
+
+	f, err := policy.Inspect(bytes.NewReader(append(bytes.Clone(png), make([]byte, 64)...)))
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if _, err := io.Copy(io.Discard, f); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("reading past the limit = %v, want ErrTooLarge", err)
+	}
+
+	f, err = policy.Inspect(bytes.NewReader(append(bytes.Clone(png), make([]byte, 64-len(png))...)))
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if _, err := io.Copy(io.Discard, f); err != nil {
+		t.Errorf("reading exactly the limit = %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	policy := Policy{MaxBytes: map[string]int64{KindImage: 64}}
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr error
+	}{
+		{"within the limit", png, nil},
+		{"declared size over the limit", append(bytes.Clone(png), make([]byte, 64)...), ErrTooLarge},
+		{"named .jpg but html", []byte("<!DOCTYPE html><p>hi</p>"), ErrUnsupportedType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := multipartFile(t, "photo.jpg", tt.content)
+			f, err := policy.Open(header)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Open error = %v, want %v", err, tt.wantErr)
+			}
+			if f != nil {
+				f.Close()
+			}
+		})
+	}
+}
+
+// multipartFile round-trips content through a multipart form, as an upload
+// handler would receive it.
+func multipartFile(t *testing.T, name string, content []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	w, err := mw.CreateFormFile("media", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(content)
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	return r.MultipartForm.File["media"][0]
+}
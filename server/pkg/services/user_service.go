@@ -1,14 +1,18 @@
 package services
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"mime/multipart"
+	"slices"
 
 	"github.com/Mahaveer86619/TrailStory/pkg/db"
 	"github.com/Mahaveer86619/TrailStory/pkg/errz"
 	"github.com/Mahaveer86619/TrailStory/pkg/middleware"
 	"github.com/Mahaveer86619/TrailStory/pkg/models"
 	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/upload"
 	"github.com/Mahaveer86619/TrailStory/pkg/utils"
 	"github.com/Mahaveer86619/TrailStory/pkg/views"
 
@@ -118,6 +122,19 @@ func (s *UserService) GetUser(userID uint) (*views.UserView, error) {
 	return &view, nil
 }
 
+// GetMe is GetUser with the storage usage, which only the user may see.
+func (s *UserService) GetMe(userID uint) (*views.UserView, error) {
+	view, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if view.Storage, err = s.storageUsage(userID); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
 func (s *UserService) GetAllUsers() ([]views.UserView, error) {
 	var users []*models.User
 	if err := s.DB.Find(&users).Error; err != nil {
@@ -220,15 +237,79 @@ func (s *UserService) UpdateUser(userID uint, req views.UpdateRequest) (*views.U
 	return &view, nil
 }
 
-func (s *UserService) UploadProfilePic(userID uint, filename string, file io.Reader) (*views.UserView, error) {
-	key, err := s.Storage.SaveProfilePic(fmt.Sprint(userID), filename, file)
+func (s *UserService) UploadProfilePic(userID uint, header *multipart.FileHeader) (*views.UserView, error) {
+	file, err := upload.AvatarPolicy.Open(header)
+	if err != nil {
+		return nil, uploadError(header.Filename, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, uploadError(header.Filename, err)
+	}
+
+	// The same file type reuses the same keys, so the old avatar may be
+	// overwritten before the row is; the quota lock is held throughout
+	var previous models.User
+	var key string
+	var variants models.ImageVariants
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&previous, userID).Error; err != nil {
+			return errz.New(errz.NotFound, "User not found", err)
+		}
+		// The new avatar replaces the old one
+		if err := reserveQuota(tx, userID, int64(len(data))-previous.ProfilePicSize); err != nil {
+			return err
+		}
+
+		// Named after the sniffed type; the client's file name is not trusted
+		filename := "avatar" + file.Ext()
+		if key, err = s.Storage.SaveProfilePic(fmt.Sprint(userID), filename, bytes.NewReader(data)); err != nil {
+			return errz.New(errz.InternalServerError, "Failed to save image", err)
+		}
+		if variants, err = s.saveAvatarVariants(userID, filename, data); err != nil {
+			return errz.New(errz.InternalServerError, "Failed to save image", err)
+		}
+
+		updates := variantColumns("profile_pic_", variants)
+		updates["profile_pic"] = key
+		updates["profile_pic_size"] = int64(len(data))
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+			return errz.New(errz.InternalServerError, "Failed to update user profile", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, errz.New(errz.InternalServerError, "Failed to save image", err)
+		return nil, err
+	}
+
+	// The same file type reuses the same keys; only drop the ones replaced
+	current := storedKeys(key, variants)
+	var replaced []string
+	for _, old := range storedKeys(previous.ProfilePic, previous.ProfilePicVariants) {
+		if !slices.Contains(current, old) {
+			replaced = append(replaced, old)
+		}
+	}
+	go deleteStored(s.Storage, replaced)
+
+	return s.GetUser(userID)
+}
+
+func (s *UserService) RemoveProfilePic(userID uint) (*views.UserView, error) {
+	var user models.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		return nil, errz.New(errz.NotFound, "User not found", err)
 	}
 
-	if err := s.DB.Model(&models.User{}).Where("id = ?", userID).Update("profile_pic", key).Error; err != nil {
+	updates := variantColumns("profile_pic_", models.ImageVariants{})
+	updates["profile_pic"] = ""
+	updates["profile_pic_size"] = 0
+	if err := s.DB.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
 		return nil, errz.New(errz.InternalServerError, "Failed to update user profile", err)
 	}
+	go deleteStored(s.Storage, storedKeys(user.ProfilePic, user.ProfilePicVariants))
 
 	return s.GetUser(userID)
 }
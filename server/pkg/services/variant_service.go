@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/imaging"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+)
+
+// Rows are backfilled in pages of this size, by ascending ID.
+const backfillPageSize = 100
+
+// saveVariants renders the resized copies of an image and stores them next to
+// the original through save. Formats we cannot decode get no variants; that
+// is not an error, the views then fall back to the original.
+func saveVariants(data []byte, filename string, save func(filename string, file io.Reader) (string, error)) (models.ImageVariants, error) {
+	var variants models.ImageVariants
+
+	renditions, err := imaging.Render(data)
+	if err != nil {
+		if !errors.Is(err, imaging.ErrUnsupported) {
+			log.Printf("Skipping variants of %s: %v", filename, err)
+		}
+		return variants, nil
+	}
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	for _, r := range renditions {
+		key, err := save(fmt.Sprintf("%s_%s%s", base, r.Name, r.Ext), bytes.NewReader(r.Data))
+		if err != nil {
+			return models.ImageVariants{}, err
+		}
+
+		switch r.Name {
+		case "thumb":
+			variants.Thumb = key
+		case "medium":
+			variants.Medium = key
+		case "full":
+			variants.Full = key
+		}
+	}
+	return variants, nil
+}
+
+func (s *JourneyService) saveMediaVariants(journeyID, checkpointID uint, filename string, data []byte) (models.ImageVariants, error) {
+	return saveVariants(data, filename, func(name string, file io.Reader) (string, error) {
+		return s.Storage.SaveMedia(fmt.Sprint(journeyID), fmt.Sprint(checkpointID), name, file)
+	})
+}
+
+func (s *UserService) saveAvatarVariants(userID uint, filename string, data []byte) (models.ImageVariants, error) {
+	return saveVariants(data, filename, func(name string, file io.Reader) (string, error) {
+		return s.Storage.SaveProfilePic(fmt.Sprint(userID), name, file)
+	})
+}
+
+func variantColumns(prefix string, v models.ImageVariants) map[string]interface{} {
+	return map[string]interface{}{
+		prefix + "thumb":  v.Thumb,
+		prefix + "medium": v.Medium,
+		prefix + "full":   v.Full,
+	}
+}
+
+// readStored loads a stored original back into memory.
+func readStored(store storage.StorageService, key string) ([]byte, error) {
+	file, err := store.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// BackfillMediaVariants generates variants for images uploaded before they
+// existed. Rows that fail are logged and skipped. Returns how many were filled.
+func (s *JourneyService) BackfillMediaVariants() (int, error) {
+	filled := 0
+	var lastID uint
+
+	for {
+		var page []models.Media
+		err := s.DB.Where("type = ? AND url_thumb = '' AND id > ?", "image", lastID).
+			Order("id asc").Limit(backfillPageSize).Find(&page).Error
+		if err != nil {
+			return filled, err
+		}
+		if len(page) == 0 {
+			return filled, nil
+		}
+		lastID = page[len(page)-1].ID
+
+		checkpointIDs := make([]uint, 0, len(page))
+		for _, m := range page {
+			checkpointIDs = append(checkpointIDs, m.CheckpointID)
+		}
+		var checkpoints []models.Checkpoint
+		if err := s.DB.Select("id, journey_id").Where("id IN ?", checkpointIDs).Find(&checkpoints).Error; err != nil {
+			return filled, err
+		}
+		journeyOf := make(map[uint]uint, len(checkpoints))
+		for _, cp := range checkpoints {
+			journeyOf[cp.ID] = cp.JourneyID
+		}
+
+		for _, m := range page {
+			journeyID, ok := journeyOf[m.CheckpointID]
+			if !ok {
+				continue // Its checkpoint is deleted
+			}
+
+			data, err := readStored(s.Storage, m.URL)
+			if err != nil {
+				log.Printf("Backfill media %d: reading %s: %v", m.ID, m.URL, err)
+				continue
+			}
+
+			variants, err := s.saveMediaVariants(journeyID, m.CheckpointID, filepath.Base(m.URL), data)
+			if err != nil {
+				log.Printf("Backfill media %d: saving variants: %v", m.ID, err)
+				continue
+			}
+			if variants == (models.ImageVariants{}) {
+				continue
+			}
+
+			if err := s.DB.Model(&models.Media{}).Where("id = ?", m.ID).Updates(variantColumns("url_", variants)).Error; err != nil {
+				return filled, err
+			}
+			filled++
+		}
+	}
+}
+
+// BackfillAvatarVariants is BackfillMediaVariants for profile pictures.
+func (s *UserService) BackfillAvatarVariants() (int, error) {
+	filled := 0
+	var lastID uint
+
+	for {
+		var page []models.User
+		err := s.DB.Where("profile_pic <> '' AND profile_pic_thumb = '' AND id > ?", lastID).
+			Order("id asc").Limit(backfillPageSize).Find(&page).Error
+		if err != nil {
+			return filled, err
+		}
+		if len(page) == 0 {
+			return filled, nil
+		}
+		lastID = page[len(page)-1].ID
+
+		for _, u := range page {
+			data, err := readStored(s.Storage, u.ProfilePic)
+			if err != nil {
+				log.Printf("Backfill user %d: reading %s: %v", u.ID, u.ProfilePic, err)
+				continue
+			}
+
+			variants, err := s.saveAvatarVariants(u.ID, filepath.Base(u.ProfilePic), data)
+			if err != nil {
+				log.Printf("Backfill user %d: saving variants: %v", u.ID, err)
+				continue
+			}
+			if variants == (models.ImageVariants{}) {
+				continue
+			}
+
+			if err := s.DB.Model(&models.User{}).Where("id = ?", u.ID).Updates(variantColumns("profile_pic_", variants)).Error; err != nil {
+				return filled, err
+			}
+			filled++
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package views
+
+import (
+	"time"
+
+	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/geocoder"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
+	"github.com/Mahaveer86619/TrailStory/pkg/utils"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+const GeoJSONContentType = "application/geo+json"
+
+// GeoJSON uses [Lng, Lat] order, unlike CheckpointView.Coords.
+
+func ToJourneyFeatureCollection(j *models.Journey, storage storage.StorageService) *geojson.FeatureCollection {
+	fc := geojson.NewFeatureCollection()
+	appendJourneyFeatures(fc, j, storage)
+	return fc
+}
+
+func ToListJourneyFeatureCollection(journeys []models.Journey, storage storage.StorageService) *geojson.FeatureCollection {
+	fc := geojson.NewFeatureCollection()
+	for i := range journeys {
+		appendJourneyFeatures(fc, &journeys[i], storage)
+	}
+	return fc
+}
+
+func appendJourneyFeatures(fc *geojson.FeatureCollection, j *models.Journey, storage storage.StorageService) {
+	journeyID := utils.MaskID(j.ID)
+	storage = MediaStorage(j.IsPublic, storage)
+
+	// The path needs at least two positions to be a valid LineString
+	if len(j.Checkpoints) >= 2 {
+		path := make(orb.LineString, 0, len(j.Checkpoints))
+		for _, cp := range j.Checkpoints {
+			path = append(path, cp.Location.Point)
+		}
+
+		status := "Ongoing"
+		if j.EndedAt != nil {
+			status = "Completed"
+		}
+
+		line := geojson.NewFeature(path)
+		line.ID = journeyID
+		line.Properties["kind"] = "path"
+		line.Properties["journey_id"] = journeyID
+		line.Properties["title"] = j.Title
+		line.Properties["status"] = status
+		line.Properties["is_public"] = j.IsPublic
+		fc.Append(line)
+	}
+
+	for _, cp := range j.Checkpoints {
+		media := make([]string, 0, len(cp.Media))
+		for _, m := range cp.Media {
+			media = append(media, storage.GetPublicURL(m.URL))
+		}
+
+		point := geojson.NewFeature(cp.Location.Point)
+		point.ID = utils.MaskID(cp.ID)
+		point.Properties["kind"] = "checkpoint"
+		point.Properties["id"] = utils.MaskID(cp.ID)
+		point.Properties["journey_id"] = journeyID
+		point.Properties["note"] = cp.Note
+		if name := cp.Place.Name(); name != "" {
+			point.Properties["place"] = name
+		}
+		point.Properties["time"] = cp.Timestamp.UTC().Format(time.RFC3339)
+		point.Properties["time_zone"] = geocoder.TimeZoneAt(cp.Location.Point.Lat(), cp.Location.Point.Lon())
+		point.Properties["media"] = media
+		fc.Append(point)
+	}
+}
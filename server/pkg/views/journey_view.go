@@ -1,53 +1,254 @@
 package views
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/Mahaveer86619/TrailStory/pkg/models"
+	"github.com/Mahaveer86619/TrailStory/pkg/services/geocoder"
 	"github.com/Mahaveer86619/TrailStory/pkg/services/storage"
 	"github.com/Mahaveer86619/TrailStory/pkg/utils"
+	"github.com/paulmach/orb"
 )
 
+type MediaView struct {
+	ID          string          `json:"id"`
+	URL         string          `json:"url"` // The original upload
+	Filename    string          `json:"filename,omitempty"`
+	Type        string          `json:"type"`
+	ContentType string          `json:"content_type,omitempty"`
+	SizeBytes   int64           `json:"size_bytes,omitempty"`
+	Sizes       *ImageSizesView `json:"sizes,omitempty"` // Images only
+}
+
+type ImageSizesView struct {
+	Thumb  string `json:"thumb"`
+	Medium string `json:"medium"`
+	Full   string `json:"full"`
+}
+
+// ToImageSizesView falls back to the original for any variant that has not
+// been generated (yet).
+func ToImageSizesView(original string, v models.ImageVariants, storage storage.StorageService) *ImageSizesView {
+	url := func(key string) string {
+		if key == "" {
+			key = original
+		}
+		return storage.GetPublicURL(key)
+	}
+
+	return &ImageSizesView{
+		Thumb:  url(v.Thumb),
+		Medium: url(v.Medium),
+		Full:   url(v.Full),
+	}
+}
+
+// MediaStorage hands out expiring signed URLs for the media of journeys that
+// are not public, so a leaked link stops working.
+func MediaStorage(isPublic bool, store storage.StorageService) storage.StorageService {
+	if isPublic {
+		return store
+	}
+	return storage.Signed(store, storage.SignedURLExpiry)
+}
+
+type PlaceView struct {
+	Locality    string `json:"locality,omitempty"`
+	Region      string `json:"region,omitempty"`
+	Country     string `json:"country,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+}
+
 type CheckpointView struct {
-	ID     string    `json:"id"`
-	Title  string    `json:"title"` // Derived from Note or Order
-	Time   string    `json:"time"`
-	Coords []float64 `json:"coords"` // [Lat, Lng] for Leaflet
-	Note   string    `json:"note"`
-	Image  string    `json:"image,omitempty"`
+	ID        string      `json:"id"`
+	Title     string      `json:"title"`      // Place name, "Checkpoint" until geocoded
+	Time      string      `json:"time"`       // RFC3339 with the offset of TimeZone
+	TimeZone  string      `json:"time_zone"`  // IANA name, from the coordinates
+	LocalTime string      `json:"local_time"` // Wall-clock time where it was taken
+	Coords    []float64   `json:"coords"`     // [Lat, Lng] for Leaflet
+	Note      string      `json:"note"`
+	Place     *PlaceView  `json:"place,omitempty"`
+	Image     string      `json:"image,omitempty"` // Medium size of the first image
+	Media     []MediaView `json:"media,omitempty"`
 }
 
 type JourneyView struct {
-	ID          string           `json:"id"`
-	Title       string           `json:"title"`
-	Description string           `json:"description"`
-	StartDate   string           `json:"start_date"`
-	Status      string           `json:"status"`
-	Visibility  string           `json:"visibility"`
-	Checkpoints []CheckpointView `json:"checkpoints"`
+	ID             string           `json:"id"`
+	Title          string           `json:"title"`
+	Description    string           `json:"description"`
+	StartDate      string           `json:"start_date"`       // RFC3339 with the offset of TimeZone
+	StartDateLocal string           `json:"start_date_local"` // Calendar date where the journey began
+	TimeZone       string           `json:"time_zone"`        // Zone of the first checkpoint, UTC without one
+	Status         string           `json:"status"`
+	Visibility     string           `json:"visibility"`
+	CoverImage     string           `json:"cover_image,omitempty"` // Medium size of the first image
+	Checkpoints    []CheckpointView `json:"checkpoints"`           // null on list summaries
+	Stats          *JourneyStats    `json:"stats,omitempty"`
+
+	Simplification *SimplificationView `json:"simplification,omitempty"`
+}
+
+type SimplificationView struct {
+	ToleranceM     float64 `json:"tolerance_m"`
+	OriginalPoints int     `json:"original_points"`
+	DroppedPoints  int     `json:"dropped_points"`
+}
+
+type NearbyJourneyView struct {
+	JourneyView
+	DistanceM float64 `json:"distance_m"` // To the nearest checkpoint
+}
+
+type ViewportCheckpointView struct {
+	CheckpointView
+	JourneyID string `json:"journey_id"`
+}
+
+type ViewportView struct {
+	Checkpoints []ViewportCheckpointView `json:"checkpoints"`
+	Journeys    []JourneyView            `json:"journeys"` // Summaries, without checkpoints
+	Truncated   bool                     `json:"truncated"`
+	Limit       int                      `json:"limit"`
+}
+
+type BatchItemResult struct {
+	ClientID string `json:"client_id"`
+	Status   string `json:"status"` // created, duplicate or invalid
+	ID       string `json:"id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type BatchCheckpointView struct {
+	Created    int               `json:"created"`
+	Duplicates int               `json:"duplicates"`
+	Invalid    int               `json:"invalid"`
+	Results    []BatchItemResult `json:"results"` // Same order as the request
+}
+
+type PhotoImportResult struct {
+	Filename string `json:"filename"`
+	Status   string `json:"status"`       // created, no_gps, invalid or error
+	ID       string `json:"id,omitempty"` // The new checkpoint
+	Error    string `json:"error,omitempty"`
+}
+
+type PhotoImportView struct {
+	Created int                 `json:"created"`
+	NoGPS   int                 `json:"no_gps"`
+	Invalid int                 `json:"invalid"`
+	Failed  int                 `json:"failed"`  // Failed on our side; safe to retry
+	Results []PhotoImportResult `json:"results"` // Same order as the upload
+}
+
+// MediaUploadView tells the client where to send a file directly. The headers
+// are part of the signature and must be sent as given.
+type MediaUploadView struct {
+	Key       string            `json:"key"` // Pass back to complete the upload
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt string            `json:"expires_at"`
+}
+
+type JourneyStats struct {
+	CheckpointCount int       `json:"checkpoint_count"`
+	DistanceM       float64   `json:"distance_m"`
+	ElapsedS        int64     `json:"elapsed_s"`
+	MovingS         int64     `json:"moving_s"`
+	AvgSpeedMps     float64   `json:"avg_speed_mps"`
+	BBox            []float64 `json:"bbox"`     // [MinLng, MinLat, MaxLng, MaxLat] as in GeoJSON
+	Centroid        []float64 `json:"centroid"` // [Lat, Lng] for Leaflet
 }
 
 func ToCheckpointView(cp *models.Checkpoint, storage storage.StorageService) CheckpointView {
 	imgUrl := ""
-	if len(cp.Media) > 0 {
-		imgUrl = storage.GetPublicURL(cp.Media[0].URL)
+	media := make([]MediaView, 0, len(cp.Media))
+	for _, m := range cp.Media {
+		view := MediaView{
+			ID:          utils.MaskID(m.ID),
+			URL:         storage.GetPublicURL(m.URL),
+			Filename:    m.Filename,
+			Type:        m.Type,
+			ContentType: m.ContentType,
+			SizeBytes:   m.SizeBytes,
+		}
+		if m.Type == "image" {
+			view.Sizes = ToImageSizesView(m.URL, m.Variants, storage)
+			if imgUrl == "" {
+				imgUrl = view.Sizes.Medium
+			}
+		}
+		media = append(media, view)
 	}
 
+	title := "Checkpoint"
+	var place *PlaceView
+	if name := cp.Place.Name(); name != "" {
+		title = name
+		place = &PlaceView{
+			Locality:    cp.Place.Locality,
+			Region:      cp.Place.Region,
+			Country:     cp.Place.Country,
+			CountryCode: cp.Place.CountryCode,
+		}
+	}
+
+	loc := geocoder.LocationAt(cp.Location.Point.Lat(), cp.Location.Point.Lon())
+	local := cp.Timestamp.In(loc)
+
 	return CheckpointView{
-		ID:     utils.MaskID(cp.ID),
-		Title:  "Checkpoint",
-		Time:   cp.Timestamp.Format("03:04 PM"),
-		Coords: []float64{cp.Location.Point[1], cp.Location.Point[0]},
-		Note:   cp.Note,
-		Image:  imgUrl,
+		ID:        utils.MaskID(cp.ID),
+		Title:     title,
+		Time:      local.Format(time.RFC3339),
+		TimeZone:  loc.String(),
+		LocalTime: local.Format("03:04 PM"),
+		Coords:    []float64{cp.Location.Point[1], cp.Location.Point[0]},
+		Note:      cp.Note,
+		Place:     place,
+		Image:     imgUrl,
+		Media:     media,
 	}
 }
 
 func ToJourneyView(j *models.Journey, storage storage.StorageService) JourneyView {
+	storage = MediaStorage(j.IsPublic, storage)
 	cps := make([]CheckpointView, 0)
-	
+
+	cover := ""
 	for _, cp := range j.Checkpoints {
-		cps = append(cps, ToCheckpointView(&cp, storage))
+		view := ToCheckpointView(&cp, storage)
+		if cover == "" {
+			cover = view.Image
+		}
+		cps = append(cps, view)
+	}
+
+	var first *orb.Point
+	if len(j.Checkpoints) > 0 {
+		first = &j.Checkpoints[0].Location.Point
+	}
+
+	view := toJourneySummaryView(j, first)
+	view.CoverImage = cover
+	view.Checkpoints = cps
+	return view
+}
+
+// ToJourneySummaryView renders a journey for list endpoints, without loading
+// its checkpoints: first is the location of the first one, nil when there is
+// none, and cover the journey's first image.
+func ToJourneySummaryView(j *models.Journey, first *orb.Point, cover *models.Media, storage storage.StorageService) JourneyView {
+	view := toJourneySummaryView(j, first)
+	if cover != nil {
+		view.CoverImage = ToImageSizesView(cover.URL, cover.Variants, MediaStorage(j.IsPublic, storage)).Medium
 	}
+	return view
+}
 
+func toJourneySummaryView(j *models.Journey, first *orb.Point) JourneyView {
 	status := "Ongoing"
 	if j.EndedAt != nil {
 		status = "Completed"
@@ -58,14 +259,21 @@ func ToJourneyView(j *models.Journey, storage storage.StorageService) JourneyVie
 		vis = "Public"
 	}
 
+	loc := time.UTC
+	if first != nil {
+		loc = geocoder.LocationAt(first.Lat(), first.Lon())
+	}
+	started := j.StartedAt.In(loc)
+
 	return JourneyView{
-		ID:          utils.MaskID(j.ID),
-		Title:       j.Title,
-		Description: j.Description,
-		StartDate:   j.StartedAt.Format("Jan 02, 2006"),
-		Status:      status,
-		Visibility:  vis,
-		Checkpoints: cps,
+		ID:             utils.MaskID(j.ID),
+		Title:          j.Title,
+		Description:    j.Description,
+		StartDate:      started.Format(time.RFC3339),
+		StartDateLocal: started.Format("Jan 02, 2006"),
+		TimeZone:       loc.String(),
+		Status:         status,
+		Visibility:     vis,
 	}
 }
 
@@ -77,8 +285,41 @@ func ToListJourneyView(journeys []models.Journey, storage storage.StorageService
 	return resp
 }
 
+// ToViewportView signs the media of checkpoints whose journey is not in
+// public, keyed by journey ID.
+func ToViewportView(checkpoints []models.Checkpoint, journeys []JourneyView, public map[uint]bool, storage storage.StorageService) ViewportView {
+	cps := make([]ViewportCheckpointView, 0, len(checkpoints))
+	for _, cp := range checkpoints {
+		cps = append(cps, ViewportCheckpointView{
+			CheckpointView: ToCheckpointView(&cp, MediaStorage(public[cp.JourneyID], storage)),
+			JourneyID:      utils.MaskID(cp.JourneyID),
+		})
+	}
+
+	if journeys == nil {
+		journeys = []JourneyView{}
+	}
+
+	return ViewportView{
+		Checkpoints: cps,
+		Journeys:    journeys,
+	}
+}
+
 // Requests
 
+// JourneyOptions tunes how journeys are rendered on read endpoints.
+type JourneyOptions struct {
+	SimplifyM float64 // Douglas-Peucker tolerance in meters, 0 disables
+}
+
+func (o JourneyOptions) Valid() error {
+	if o.SimplifyM < 0 {
+		return errors.New("simplify cannot be negative")
+	}
+	return nil
+}
+
 type CreateJourneyRequest struct {
 	Title       string `json:"title"`
 	Description string `json:"description"`
@@ -90,6 +331,19 @@ func (r CreateJourneyRequest) Valid() error {
 	return nil
 }
 
+type UpdateJourneyRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	IsPublic    *bool   `json:"is_public"`
+}
+
+func (r UpdateJourneyRequest) Valid() error {
+	if r.Title != nil && strings.TrimSpace(*r.Title) == "" {
+		return errors.New("title cannot be empty")
+	}
+	return nil
+}
+
 type CreateCheckpointRequest struct {
 	Lat       float64 `json:"lat"`
 	Lng       float64 `json:"lng"`
@@ -101,3 +355,183 @@ func (r CreateCheckpointRequest) Valid() error {
 	// Add validation logic if needed
 	return nil
 }
+
+type UpdateCheckpointRequest struct {
+	Lat       *float64 `json:"lat"`
+	Lng       *float64 `json:"lng"`
+	Note      *string  `json:"note"`
+	Timestamp *string  `json:"timestamp"`  // RFC3339
+	JourneyID *string  `json:"journey_id"` // Move to another journey of the same owner
+}
+
+func (r UpdateCheckpointRequest) Valid() error {
+	if (r.Lat == nil) != (r.Lng == nil) {
+		return errors.New("lat and lng must be provided together")
+	}
+	if r.Lat != nil && (*r.Lat < -90 || *r.Lat > 90) {
+		return errors.New("lat must be between -90 and 90")
+	}
+	if r.Lng != nil && (*r.Lng < -180 || *r.Lng > 180) {
+		return errors.New("lng must be between -180 and 180")
+	}
+	if r.JourneyID != nil && *r.JourneyID == "" {
+		return errors.New("journey_id cannot be empty")
+	}
+	return nil
+}
+
+type MediaUploadRequest struct {
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"` // The upload must be exactly this size
+}
+
+func (r MediaUploadRequest) Valid() error {
+	if strings.TrimSpace(r.ContentType) == "" {
+		return errors.New("content_type is required")
+	}
+	if r.SizeBytes <= 0 {
+		return errors.New("size_bytes must be positive")
+	}
+	return nil
+}
+
+type CompleteMediaUploadRequest struct {
+	Key string `json:"key"`
+}
+
+func (r CompleteMediaUploadRequest) Valid() error {
+	if r.Key == "" {
+		return errors.New("key is required")
+	}
+	return nil
+}
+
+type ImportJourneyRequest struct {
+	Title      string // Overrides the track name when set
+	IsPublic   bool
+	ThinMeters float64 // Minimum spacing between imported track points, 0 keeps all
+}
+
+func (r ImportJourneyRequest) Valid() error {
+	if r.ThinMeters < 0 {
+		return errors.New("thin_m cannot be negative")
+	}
+	return nil
+}
+
+type NearbyRequest struct {
+	Lat     float64
+	Lng     float64
+	RadiusM float64
+	Limit   int
+}
+
+func (r NearbyRequest) Valid() error {
+	if r.Lat < -90 || r.Lat > 90 {
+		return errors.New("lat must be between -90 and 90")
+	}
+	if r.Lng < -180 || r.Lng > 180 {
+		return errors.New("lng must be between -180 and 180")
+	}
+	if r.RadiusM <= 0 || r.RadiusM > 200000 {
+		return errors.New("radius_m must be between 0 and 200000")
+	}
+	return nil
+}
+
+type ViewportRequest struct {
+	MinLng float64
+	MinLat float64
+	MaxLng float64
+	MaxLat float64
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+}
+
+func (r ViewportRequest) Valid() error {
+	if r.MinLat < -90 || r.MaxLat > 90 || r.MinLat > r.MaxLat {
+		return errors.New("bbox latitudes must be within -90..90 and min <= max")
+	}
+	if r.MinLng < -180 || r.MinLng > 180 || r.MaxLng < -180 || r.MaxLng > 180 {
+		return errors.New("bbox longitudes must be within -180..180")
+	}
+	if r.From != nil && r.To != nil && r.From.After(*r.To) {
+		return errors.New("from must be before to")
+	}
+	return nil
+}
+
+// Boxes returns the bounding box to search, split in two at the antimeridian
+// when it crosses it (MinLng > MaxLng).
+func (r ViewportRequest) Boxes() []orb.Bound {
+	if r.MinLng <= r.MaxLng {
+		return []orb.Bound{{Min: orb.Point{r.MinLng, r.MinLat}, Max: orb.Point{r.MaxLng, r.MaxLat}}}
+	}
+	return []orb.Bound{
+		{Min: orb.Point{r.MinLng, r.MinLat}, Max: orb.Point{180, r.MaxLat}},
+		{Min: orb.Point{-180, r.MinLat}, Max: orb.Point{r.MaxLng, r.MaxLat}},
+	}
+}
+
+const (
+	BatchStatusCreated   = "created"
+	BatchStatusDuplicate = "duplicate"
+	BatchStatusInvalid   = "invalid"
+)
+
+// MaxBatchCheckpoints caps a single offline sync upload.
+const MaxBatchCheckpoints = 1000
+
+const (
+	PhotoStatusCreated = "created"
+	PhotoStatusNoGPS   = "no_gps"
+	PhotoStatusInvalid = "invalid"
+	PhotoStatusError   = "error"
+)
+
+// MaxPhotoImport caps the number of photos in one upload.
+const MaxPhotoImport = 200
+
+type BatchCheckpointItem struct {
+	ClientID  string  `json:"client_id"`
+	Lat       float64 `json:"lat"`
+	Lng       float64 `json:"lng"`
+	Note      string  `json:"note"`
+	Timestamp string  `json:"timestamp"` // RFC3339, defaults to upload time
+}
+
+func (r BatchCheckpointItem) Valid() error {
+	if r.ClientID == "" {
+		return errors.New("client_id is required")
+	}
+	if len(r.ClientID) > 64 {
+		return errors.New("client_id cannot be longer than 64 characters")
+	}
+	if r.Lat < -90 || r.Lat > 90 {
+		return errors.New("lat must be between -90 and 90")
+	}
+	if r.Lng < -180 || r.Lng > 180 {
+		return errors.New("lng must be between -180 and 180")
+	}
+	if r.Timestamp != "" {
+		if _, err := time.Parse(time.RFC3339, r.Timestamp); err != nil {
+			return errors.New("timestamp must be RFC3339")
+		}
+	}
+	return nil
+}
+
+type BatchCheckpointRequest struct {
+	Checkpoints []BatchCheckpointItem `json:"checkpoints"`
+}
+
+func (r BatchCheckpointRequest) Valid() error {
+	if len(r.Checkpoints) == 0 {
+		return errors.New("checkpoints cannot be empty")
+	}
+	if len(r.Checkpoints) > MaxBatchCheckpoints {
+		return fmt.Errorf("a batch cannot contain more than %d checkpoints", MaxBatchCheckpoints)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package views
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paulmach/orb"
+)
+
+func TestViewportRequestValid(t *testing.T) {
+	earlier := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		req     ViewportRequest
+		wantErr bool
+	}{
+		{"ordinary box", ViewportRequest{MinLng: -3.2, MinLat: 54.4, MaxLng: -3.0, MaxLat: 54.5}, false},
+		{"crosses the antimeridian", ViewportRequest{MinLng: 170, MinLat: -20, MaxLng: -170, MaxLat: -10}, false},
+		{"whole world", ViewportRequest{MinLng: -180, MinLat: -90, MaxLng: 180, MaxLat: 90}, false},
+		{"latitudes swapped", ViewportRequest{MinLng: 0, MinLat: 10, MaxLng: 1, MaxLat: 5}, true},
+		{"latitude out of range", ViewportRequest{MinLng: 0, MinLat: -91, MaxLng: 1, MaxLat: 0}, true},
+		{"longitude out of range", ViewportRequest{MinLng: 0, MinLat: 0, MaxLng: 180.5, MaxLat: 1}, true},
+		{"time range", ViewportRequest{MaxLng: 1, MaxLat: 1, From: &earlier, To: &later}, false},
+		{"time range reversed", ViewportRequest{MaxLng: 1, MaxLat: 1, From: &later, To: &earlier}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Valid(); (err != nil) != tt.wantErr {
+				t.Errorf("Valid() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestViewportRequestBoxes(t *testing.T) {
+	bound := func(minLng, minLat, maxLng, maxLat float64) orb.Bound {
+		return orb.Bound{Min: orb.Point{minLng, minLat}, Max: orb.Point{maxLng, maxLat}}
+	}
+
+	tests := []struct {
+		name string
+		req  ViewportRequest
+		want []orb.Bound
+	}{
+		{
+			"ordinary box",
+			ViewportRequest{MinLng: -3.2, MinLat: 54.4, MaxLng: -3.0, MaxLat: 54.5},
+			[]orb.Bound{bound(-3.2, 54.4, -3.0, 54.5)},
+		},
+		{
+			"single meridian",
+			ViewportRequest{MinLng: 10, MinLat: 0, MaxLng: 10, MaxLat: 1},
+			[]orb.Bound{bound(10, 0, 10, 1)},
+		},
+		{
+			"crosses the antimeridian",
+			ViewportRequest{MinLng: 170, MinLat: -20, MaxLng: -170, MaxLat: -10},
+			[]orb.Bound{bound(170, -20, 180, -10), bound(-180, -20, -170, -10)},
+		},
+		{
+			"ends on the antimeridian",
+			ViewportRequest{MinLng: 170, MinLat: 0, MaxLng: 180, MaxLat: 1},
+			[]orb.Bound{bound(170, 0, 180, 1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.req.Boxes()
+			if len(got) != len(tt.want) {
+				t.Fatalf("Boxes() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("Boxes()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
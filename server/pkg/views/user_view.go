@@ -15,6 +15,25 @@ type UserView struct {
 	DisplayName string    `json:"display_name"`
 	ProfilePic  string    `json:"profile_pic_url"`
 	CreatedAt   time.Time `json:"created_at"`
+
+	ProfilePicSizes *ImageSizesView   `json:"profile_pic_sizes,omitempty"`
+	Storage         *StorageUsageView `json:"storage,omitempty"` // Own profile only
+}
+
+// StorageUsageView reports what counts towards the quota: every uploaded
+// file at its uploaded size. Thumbnails and resized copies generated from
+// images are not counted.
+type StorageUsageView struct {
+	UsedBytes  int64  `json:"used_bytes"`
+	LimitBytes *int64 `json:"limit_bytes"` // null when there is no quota
+}
+
+func ToStorageUsageView(used, limit int64) *StorageUsageView {
+	view := &StorageUsageView{UsedBytes: used}
+	if limit > 0 {
+		view.LimitBytes = &limit
+	}
+	return view
 }
 
 type AuthResponse struct {
@@ -25,16 +44,19 @@ type AuthResponse struct {
 
 func ToUserView(u *models.User, storage storage.StorageService) UserView {
 	url := ""
+	var sizes *ImageSizesView
 	if u.ProfilePic != "" {
 		url = storage.GetPublicURL(u.ProfilePic)
+		sizes = ToImageSizesView(u.ProfilePic, u.ProfilePicVariants, storage)
 	}
 
 	return UserView{
-		ID:          utils.MaskID(u.ID),
-		Email:       u.Email,
-		DisplayName: u.DisplayName,
-		ProfilePic:  url,
-		CreatedAt:   u.CreatedAt,
+		ID:              utils.MaskID(u.ID),
+		Email:           u.Email,
+		DisplayName:     u.DisplayName,
+		ProfilePic:      url,
+		CreatedAt:       u.CreatedAt,
+		ProfilePicSizes: sizes,
 	}
 }
 
@@ -7,12 +7,20 @@ export interface User {
   email: string;
   profile_pic_url?: string;
   created_at?: string;
+  storage?: StorageUsage; // Only on GET /users/me
+}
+
+export interface StorageUsage {
+  used_bytes: number;
+  limit_bytes: number | null; // null when there is no quota
 }
 
 export interface Checkpoint {
   id: string;
   title: string;
-  time: string;
+  time: string; // RFC3339 in time_zone
+  time_zone: string;
+  local_time: string;
   coords: [number, number]; // [Lat, Lng]
   note: string;
   image?: string;
@@ -24,8 +32,11 @@ export interface Journey {
   description?: string;
   status: 'Ongoing' | 'Completed';
   start_date: string;
+  start_date_local: string;
+  time_zone: string;
   visibility: 'Private' | 'Public';
-  checkpoints?: Checkpoint[] | null;
+  cover_image?: string;
+  checkpoints?: Checkpoint[] | null; // null on list summaries
 }
 
 export interface ApiResponse<T> {
@@ -72,13 +72,14 @@ const JourneyView = () => {
   const timelineRef = useRef<HTMLDivElement>(null);
 
   useEffect(() => {
-    if (location.state?.journey) {
+    // Feed entries are summaries; only the full journey has checkpoints
+    if (location.state?.journey?.checkpoints) {
       setJourney(location.state.journey);
       setLoading(false);
       return;
     }
 
-    if (!isAuthenticated()) {
+    if (!location.state?.journey && !isAuthenticated()) {
       navigate('/login');
       return;
     }
@@ -198,7 +199,7 @@ const JourneyView = () => {
                         {checkpoint.title}
                       </h3>
                       <p className="text-sm text-muted-foreground mb-2">
-                        {checkpoint.time}
+                        {checkpoint.local_time}
                       </p>
                       {checkpoint.note && (
                         <p className="text-sm text-foreground">{checkpoint.note}</p>
@@ -313,7 +314,7 @@ const JourneyView = () => {
                           </h3>
                           <div className="flex items-center gap-2 mt-1 text-muted-foreground">
                             <Clock className="w-3.5 h-3.5" />
-                            <span className="text-sm">{checkpoint.time}</span>
+                            <span className="text-sm">{checkpoint.local_time}</span>
                           </div>
                         </div>
                         <ChevronRight className={`w-5 h-5 text-muted-foreground transition-transform ${
@@ -257,9 +257,9 @@ const Landing = () => {
                   className="group bg-card rounded-xl border border-border overflow-hidden cursor-pointer hover:shadow-lg hover:border-primary/30 transition-all duration-300"
                 >
                   <div className="h-40 bg-muted relative overflow-hidden">
-                     {journey.checkpoints && journey.checkpoints.length > 0 && journey.checkpoints[0].image ? (
+                     {journey.cover_image ? (
                         <img 
-                          src={journey.checkpoints[0].image} 
+                          src={journey.cover_image} 
                           alt={journey.title}
                           className="w-full h-full object-cover transition-transform duration-500 group-hover:scale-110"
                         />
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_checkpoints_location_geog;
\ No newline at end of file
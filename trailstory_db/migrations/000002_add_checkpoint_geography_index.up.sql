@@ -0,0 +1,3 @@
+-- Geography searches (ST_DWithin in meters) cast location, which the plain
+-- geometry index cannot serve.
+CREATE INDEX IF NOT EXISTS idx_checkpoints_location_geog ON checkpoints USING GIST ((location::geography));
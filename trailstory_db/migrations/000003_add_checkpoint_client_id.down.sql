@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_checkpoints_journey_client_id;
+ALTER TABLE checkpoints DROP COLUMN IF EXISTS client_id;
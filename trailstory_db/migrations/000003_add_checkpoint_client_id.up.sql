@@ -0,0 +1,5 @@
+-- Client-generated IDs let offline devices retry batch uploads without
+-- creating duplicates. NULLs are distinct, so server-created rows are unaffected.
+ALTER TABLE checkpoints ADD COLUMN IF NOT EXISTS client_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_checkpoints_journey_client_id ON checkpoints (journey_id, client_id);
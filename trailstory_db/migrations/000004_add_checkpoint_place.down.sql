@@ -0,0 +1,4 @@
+ALTER TABLE checkpoints DROP COLUMN IF EXISTS place_country_code;
+ALTER TABLE checkpoints DROP COLUMN IF EXISTS place_country;
+ALTER TABLE checkpoints DROP COLUMN IF EXISTS place_region;
+ALTER TABLE checkpoints DROP COLUMN IF EXISTS place_locality;
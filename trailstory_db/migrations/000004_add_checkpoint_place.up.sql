@@ -0,0 +1,5 @@
+-- Reverse-geocoded place name of each checkpoint. Empty until resolved.
+ALTER TABLE checkpoints ADD COLUMN IF NOT EXISTS place_locality TEXT NOT NULL DEFAULT '';
+ALTER TABLE checkpoints ADD COLUMN IF NOT EXISTS place_region TEXT NOT NULL DEFAULT '';
+ALTER TABLE checkpoints ADD COLUMN IF NOT EXISTS place_country TEXT NOT NULL DEFAULT '';
+ALTER TABLE checkpoints ADD COLUMN IF NOT EXISTS place_country_code TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+ALTER TABLE users DROP COLUMN IF EXISTS profile_pic_full;
+ALTER TABLE users DROP COLUMN IF EXISTS profile_pic_medium;
+ALTER TABLE users DROP COLUMN IF EXISTS profile_pic_thumb;
+
+ALTER TABLE media DROP COLUMN IF EXISTS url_full;
+ALTER TABLE media DROP COLUMN IF EXISTS url_medium;
+ALTER TABLE media DROP COLUMN IF EXISTS url_thumb;
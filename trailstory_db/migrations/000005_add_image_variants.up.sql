@@ -0,0 +1,9 @@
+-- Storage keys of the resized copies of images. Empty until generated;
+-- `go run ./cmd/backfill` fills them in for existing rows.
+ALTER TABLE media ADD COLUMN IF NOT EXISTS url_thumb TEXT NOT NULL DEFAULT '';
+ALTER TABLE media ADD COLUMN IF NOT EXISTS url_medium TEXT NOT NULL DEFAULT '';
+ALTER TABLE media ADD COLUMN IF NOT EXISTS url_full TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_pic_thumb TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_pic_medium TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_pic_full TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE media DROP COLUMN IF EXISTS size_bytes;
+ALTER TABLE media DROP COLUMN IF EXISTS content_type;
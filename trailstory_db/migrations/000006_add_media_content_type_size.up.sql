@@ -0,0 +1,5 @@
+-- Content type sniffed from the uploaded bytes, and the stored size.
+-- Rows uploaded before validation existed keep an empty type and size 0
+-- until `make backfill` records their size.
+ALTER TABLE media ADD COLUMN IF NOT EXISTS content_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE media ADD COLUMN IF NOT EXISTS size_bytes BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- The name the file was uploaded with. Only metadata: storage keys are
+-- generated by the server. Rows uploaded before keep an empty name.
+ALTER TABLE media ADD COLUMN IF NOT EXISTS filename TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Size of the stored avatar, counted towards the user's storage quota.
+-- Avatars uploaded before quotas existed count as 0 until `make backfill`.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_pic_size BIGINT NOT NULL DEFAULT 0;
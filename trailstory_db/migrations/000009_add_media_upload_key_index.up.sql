@@ -0,0 +1,3 @@
+-- A direct upload is recorded once: two media rows for one uploaded object
+-- would each delete it when removed. Deduplicated keys are shared on purpose.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_media_upload_url ON media (url) WHERE url LIKE 'journeys/%/upload\_%';